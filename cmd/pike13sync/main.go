@@ -1,19 +1,42 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dcotelessa/pike13sync/internal/calendar"
 	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/filter"
 	"github.com/dcotelessa/pike13sync/internal/pike13"
+	"github.com/dcotelessa/pike13sync/internal/state"
 	"github.com/dcotelessa/pike13sync/internal/sync"
 	"github.com/dcotelessa/pike13sync/internal/util"
 )
 
+// Commands understood by pike13sync; sync is used when none is given
+const (
+	commandSync   = "sync"
+	commandPlan   = "plan"
+	commandApply  = "apply"
+	commandState  = "state"
+	commandDedupe = "dedupe"
+)
+
+// options holds the command-line settings used by the commands
+type options struct {
+	fromDate string
+	toDate   string
+	debug    bool
+	sample   bool
+	planPath string
+	outPath  string
+}
+
 func main() {
 	// Look for a .env file in the project root and load it
 	envFile := ""
@@ -28,7 +51,7 @@ func main() {
 		fmt.Printf("Error loading .env file: %v\n", err)
 		fmt.Println("Continuing with existing environment variables")
 	}
-
+	
 	// Setup logging
 	logFile, err := util.SetupLogging()
 	if err != nil {
@@ -37,7 +60,10 @@ func main() {
 	} else if logFile != nil {
 		defer logFile.Close()
 	}
-
+	
+	// The command comes first; flags may follow it
+	command, args := splitCommand(os.Args[1:])
+	
 	// Parse command-line flags
 	dryRunFlag := flag.Bool("dry-run", false, "Dry run mode - don't actually modify Google Calendar")
 	testFromDate := flag.String("from", "", "Test from date (format: 2025-01-01)")
@@ -46,31 +72,114 @@ func main() {
 	sampleOnly := flag.Bool("sample", false, "Only fetch and display sample events without syncing")
 	configPath := flag.String("config", "", "Path to config file")
 	showEnv := flag.Bool("show-env", false, "Show environment information and exit")
-	flag.Parse()
-
+	planPath := flag.String("plan", "", "Plan file to execute (apply command)")
+	outPath := flag.String("out", "", "Write the plan as JSON to this file (plan command)")
+	force := flag.Bool("force", false, "Apply the plan even if it exceeds the deletion safeguards")
+	forceUpdate := flag.Bool("force-update", false, "Update every synced event even if its content is unchanged")
+	flag.CommandLine.Parse(args)
+	
 	// Load configuration
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Printf("Error loading configuration: %v", err)
 	}
-
+	
 	// Override with command-line flag if specified
 	if *dryRunFlag {
 		cfg.DryRun = true
 	}
-
+	
+	if *force {
+		cfg.Force = true
+	}
+	
+	if *forceUpdate {
+		cfg.ForceUpdate = true
+	}
+	
 	if *showEnv {
 		util.DisplayEnvironmentInfo(cfg)
 		return
 	}
+	
+	opts := options{
+		fromDate: *testFromDate,
+		toDate:   *testToDate,
+		debug:    *debugMode,
+		sample:   *sampleOnly,
+		planPath: *planPath,
+		outPath:  *outPath,
+	}
+	
+	var exitCode int
+	switch command {
+	case commandSync, commandPlan:
+		exitCode = runSync(cfg, command, opts)
+	case commandApply:
+		exitCode = runApply(cfg, opts)
+	case commandState:
+		exitCode = runState(cfg, flag.Args())
+	case commandDedupe:
+		exitCode = runDedupe(cfg, opts)
+	default:
+		log.Printf("Unknown command %q (expected %s, %s, %s, %s or %s)",
+			command, commandSync, commandPlan, commandApply, commandState, commandDedupe)
+		exitCode = 2
+	}
+	
+	if exitCode != 0 {
+		if logFile != nil {
+			logFile.Close()
+		}
+		os.Exit(exitCode)
+	}
+}
 
+// splitCommand separates an optional leading command from the flags
+func splitCommand(args []string) (string, []string) {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+	return commandSync, args
+}
+
+// runSync fetches Pike13 events and plans the calendar changes. The sync
+// command applies the plan unless in dry run mode; the plan command only
+// shows it and optionally saves it for a later apply.
+func runSync(cfg *config.Config, command string, opts options) int {
+	started := time.Now()
+	
 	// Calculate date range
-	fromDate, toDate := calculateDateRange(*testFromDate, *testToDate)
+	fromDate, toDate, err := calculateDateRange(cfg, util.SystemClock{}, opts.fromDate, opts.toDate)
+	if err != nil {
+		log.Printf("Error calculating sync window: %v", err)
+		return 1
+	}
+	
+	// Check the filter rules, templates, colors and policies before fetching anything
+	eventFilter, err := newFilter(cfg)
+	if err != nil {
+		log.Printf("Error in filter rules: %v", err)
+		return 1
+	}
+	if _, err := calendar.NewTemplates(cfg); err != nil {
+		log.Printf("Error in event templates: %v", err)
+		return 1
+	}
+	if _, err := calendar.NewColorRules(cfg); err != nil {
+		log.Printf("Error in color rules: %v", err)
+		return 1
+	}
+	if err := sync.CheckPolicies(cfg); err != nil {
+		log.Printf("Error in configuration: %v", err)
+		return 1
+	}
+	
 	log.Printf("Fetching events from %s to %s", fromDate, toDate)
-	if cfg.DryRun || *debugMode {
+	if cfg.DryRun || opts.debug {
 		fmt.Printf("DRY RUN MODE: Fetching events from %s to %s\n", fromDate, toDate)
 	}
-
+	
 	// Fetch Pike13 events
 	pike13Client := pike13.NewClient(cfg)
 	events, err := pike13Client.FetchEvents(fromDate, toDate)
@@ -80,34 +189,300 @@ func main() {
 			log.Fatal("No events retrieved, exiting")
 		}
 	}
-
+	
 	eventCount := len(events.EventOccurrences)
 	log.Printf("Retrieved %d events from Pike13", eventCount)
-	if cfg.DryRun || *debugMode {
+	if cfg.DryRun || opts.debug {
 		fmt.Printf("Retrieved %d events from Pike13\n", eventCount)
 	}
-
+	
 	// If sample-only mode, just display events and exit
-	if *sampleOnly {
+	if opts.sample {
 		pike13Client.DisplaySampleEvents(events)
-		return
+		return 0
+	}
+	
+	// Set up Google Calendar service
+	calendarService, err := calendar.NewService(cfg)
+	if err != nil {
+		log.Fatalf("Error setting up Google Calendar: %v", err)
 	}
+	
+	// Work out what needs to change
+	syncService := sync.NewSyncService(calendarService, cfg)
+	if eventFilter != nil {
+		syncService.SetFilter(eventFilter)
+	}
+	st := loadState(cfg)
+	if st != nil {
+		syncService.SetState(st)
+	}
+	plan, err := syncService.Plan(events.EventOccurrences, fromDate, toDate)
+	if err != nil {
+		log.Fatalf("Error planning sync: %v", err)
+	}
+	
+	if command == commandPlan {
+		plan.Describe(os.Stdout)
+		warnUnsafe(plan, cfg)
+		if opts.outPath != "" {
+			if err := sync.WritePlan(opts.outPath, plan); err != nil {
+				log.Printf("Error saving plan: %v", err)
+				return 1
+			}
+			log.Printf("Plan written to %s; run 'apply --plan %s' to execute it", opts.outPath, opts.outPath)
+		}
+		return 0
+	}
+	
+	// A dry run is simply a plan that is never applied
+	if cfg.DryRun {
+		plan.Describe(os.Stdout)
+		warnUnsafe(plan, cfg)
+		printSummary(plan.Stats(), true)
+		return 0
+	}
+	
+	return applyPlan(syncService, plan, st, command, started)
+}
 
+// runApply executes a plan previously saved by the plan command
+func runApply(cfg *config.Config, opts options) int {
+	started := time.Now()
+	if opts.planPath == "" {
+		log.Printf("The %s command requires --plan <file>", commandApply)
+		return 2
+	}
+	
+	plan, err := sync.ReadPlan(opts.planPath)
+	if err != nil {
+		log.Printf("Error loading plan: %v", err)
+		return 1
+	}
+	if plan.CalendarID != cfg.CalendarID {
+		log.Printf("Plan was made for calendar %s but the configured calendar is %s", plan.CalendarID, cfg.CalendarID)
+		return 1
+	}
+	log.Printf("Applying plan created at %s for %s to %s (%d operations)",
+		plan.CreatedAt.Format(time.RFC3339), plan.From, plan.To, len(plan.Operations))
+	
+	if cfg.DryRun {
+		plan.Describe(os.Stdout)
+		warnUnsafe(plan, cfg)
+		printSummary(plan.Stats(), true)
+		return 0
+	}
+	
 	// Set up Google Calendar service
 	calendarService, err := calendar.NewService(cfg)
 	if err != nil {
 		log.Fatalf("Error setting up Google Calendar: %v", err)
 	}
+	
+	syncService := sync.NewSyncService(calendarService, cfg)
+	st := loadState(cfg)
+	if st != nil {
+		syncService.SetState(st)
+	}
+	return applyPlan(syncService, plan, st, commandApply, started)
+}
 
-	// Sync events
+// runDedupe finds synced events that exist more than once in the date range
+// and deletes the extra copies, or only reports them in dry run mode or when
+// duplicate_policy is "report"
+func runDedupe(cfg *config.Config, opts options) int {
+	started := time.Now()
+	fromDate, toDate, err := calculateDateRange(cfg, util.SystemClock{}, opts.fromDate, opts.toDate)
+	if err != nil {
+		log.Printf("Error calculating sync window: %v", err)
+		return 1
+	}
+	if err := sync.CheckPolicies(cfg); err != nil {
+		log.Printf("Error in configuration: %v", err)
+		return 1
+	}
+	log.Printf("Looking for duplicate events from %s to %s", fromDate, toDate)
+	
+	// Set up Google Calendar service
+	calendarService, err := calendar.NewService(cfg)
+	if err != nil {
+		log.Fatalf("Error setting up Google Calendar: %v", err)
+	}
+	
 	syncService := sync.NewSyncService(calendarService, cfg)
-	stats := syncService.SyncEvents(events.EventOccurrences)
+	plan, err := syncService.PlanDedupe(fromDate, toDate)
+	if err != nil {
+		log.Printf("Error looking for duplicates: %v", err)
+		return 1
+	}
+	plan.Describe(os.Stdout)
+	log.Printf("Found %d duplicate event(s)", len(plan.Duplicates))
+	
+	if cfg.DryRun || len(plan.Operations) == 0 {
+		return 0
+	}
+	
+	st := loadState(cfg)
+	if st != nil {
+		syncService.SetState(st)
+	}
+	return applyPlan(syncService, plan, st, commandDedupe, started)
+}
+
+// applyPlan applies a plan, records the run in the state store and reports
+// the outcome as an exit code
+func applyPlan(syncService *sync.SyncService, plan *sync.SyncPlan, st *state.State, command string, started time.Time) int {
+	stats, err := syncService.Apply(plan)
+	if st != nil {
+		saveRun(st, state.Run{
+			StartedAt:  started.UTC(),
+			FinishedAt: time.Now().UTC(),
+			Command:    command,
+			From:       plan.From,
+			To:         plan.To,
+			FromState:  plan.FromState,
+			Created:    stats.Created,
+			Updated:    stats.Updated,
+			Deleted:    stats.Deleted,
+			Skipped:    stats.Skipped,
+			Failed:     stats.Failed,
+		}, err)
+	}
+	if err != nil {
+		log.Printf("Error applying plan: %v", err)
+		if errors.Is(err, sync.ErrUnsafePlan) {
+			log.Printf("Nothing was changed. Review the plan and rerun with --force if the deletions are intended")
+		}
+		return 1
+	}
+	printSummary(stats, false)
+	return exitStatus(stats)
+}
+
+// warnUnsafe logs when applying a plan would be refused by the deletion safeguards
+func warnUnsafe(plan *sync.SyncPlan, cfg *config.Config) {
+	if err := plan.CheckSafeguards(cfg); err != nil {
+		log.Printf("Warning: %v; applying this plan will require --force", err)
+	}
+}
 
-	// Print summary
-	printSummary(stats, cfg.DryRun)
+// exitStatus fails the run when any calendar operation failed so schedulers
+// and CI notice partial syncs
+func exitStatus(stats sync.SyncStats) int {
+	if stats.Failed > 0 {
+		log.Printf("%d calendar operation(s) failed, exiting with error", stats.Failed)
+		return 1
+	}
+	return 0
+}
+
+// loadState opens the local sync state, or returns nil when it is disabled
+// or unreadable. A broken state file must never stop a sync.
+func loadState(cfg *config.Config) *state.State {
+	if cfg.StatePath == "" {
+		return nil
+	}
+	
+	st, err := state.Load(cfg.StatePath)
+	if err != nil {
+		log.Printf("Warning: ignoring sync state: %v", err)
+		return nil
+	}
+	return st
+}
+
+// saveRun adds a run to the state history and writes the state
+func saveRun(st *state.State, run state.Run, runErr error) {
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+	st.AddRun(run)
+	if err := st.Save(); err != nil {
+		log.Printf("Warning: could not save sync state: %v", err)
+	}
 }
 
-func calculateDateRange(testFrom, testTo string) (string, string) {
+// runState implements the state command: "show" (the default) prints the
+// tracked events and recent runs, "reset" forgets everything, including the
+// calendar cache used by incremental_sync
+func runState(cfg *config.Config, args []string) int {
+	if cfg.StatePath == "" {
+		log.Printf("The sync state is disabled (state_path is empty)")
+		return 1
+	}
+	
+	st, err := state.Load(cfg.StatePath)
+	if err != nil {
+		log.Printf("Error loading sync state: %v", err)
+		return 1
+	}
+	
+	action := "show"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	
+	switch action {
+	case "show":
+		showState(st)
+		return 0
+	case "reset":
+		st.Reset()
+		if err := st.Save(); err != nil {
+			log.Printf("Error saving sync state: %v", err)
+			return 1
+		}
+		log.Printf("Sync state at %s has been reset", st.Path())
+		
+		// The next incremental read must start from scratch as well
+		if cfg.CalendarCachePath != "" {
+			if err := os.Remove(cfg.CalendarCachePath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: could not remove calendar cache: %v", err)
+			}
+		}
+		return 0
+	}
+	
+	log.Printf("Unknown state action %q (expected show or reset)", action)
+	return 2
+}
+
+// showState prints the contents of the sync state
+func showState(st *state.State) {
+	fmt.Printf("\n==== SYNC STATE ====\n")
+	fmt.Printf("File: %s\n", st.Path())
+	fmt.Printf("Tracked events: %d\n", len(st.Events))
+	
+	for _, pike13ID := range st.IDs() {
+		entry, _ := st.Get(pike13ID)
+		fmt.Printf("  %s: %s (%s) -> %s, last synced %s\n",
+			pike13ID, entry.Summary, util.FormatDateTime(entry.Start), entry.EventID,
+			entry.LastSynced.Local().Format(time.RFC1123))
+	}
+	
+	fmt.Printf("Recent runs:\n")
+	if len(st.Runs) == 0 {
+		fmt.Printf("  none\n")
+	}
+	for _, run := range st.Runs {
+		fmt.Printf("  %s %s: %d created, %d updated, %d deleted, %d unchanged, %d failed",
+			run.StartedAt.Local().Format(time.RFC1123), run.Command,
+			run.Created, run.Updated, run.Deleted, run.Skipped, run.Failed)
+		if run.FromState {
+			fmt.Printf(" (calendar listing unavailable)")
+		}
+		if run.Error != "" {
+			fmt.Printf(" - %s", run.Error)
+		}
+		fmt.Printf("\n")
+	}
+	fmt.Printf("====================\n")
+}
+
+// calculateDateRange returns the sync window: the explicit --from/--to dates
+// when both are given, otherwise the rolling window configured by week_start,
+// lookback_days, lookahead_days and lookahead_weeks in the configured time zone
+func calculateDateRange(cfg *config.Config, clock util.Clock, testFrom, testTo string) (string, string, error) {
 	if testFrom != "" && testTo != "" {
 		// Add time component if missing
 		if len(testFrom) == 10 {
@@ -116,46 +491,65 @@ func calculateDateRange(testFrom, testTo string) (string, string) {
 		if len(testTo) == 10 {
 			testTo += "T00:00:00Z"
 		}
-		return testFrom, testTo
+		return testFrom, testTo, nil
 	}
-
-	now := time.Now()
 	
-	// Special handling for Saturday
-	if now.Weekday() == time.Saturday {
-		// Start from today (Saturday)
-		startDate := now
-		
-		// Calculate days until next Sunday (1 day from Saturday)
-		daysUntilNextSunday := 1
-		
-		// Then add 7 more days to get to the following Sunday
-		endDate := startDate.AddDate(0, 0, daysUntilNextSunday+7)
-		
-		return startDate.Format(time.RFC3339), endDate.Format(time.RFC3339)
+	weekStart, err := util.ParseWeekday(cfg.WeekStart)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid week_start: %v", err)
+	}
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid time zone %q: %v", cfg.TimeZone, err)
 	}
 	
-	// For all other days, get Sunday to Sunday
-	// Calculate the most recent Sunday (start of week)
-	daysToSubtract := int(now.Weekday())
-	startOfWeek := now.AddDate(0, 0, -daysToSubtract)
-	
-	// End date is 7 days after start date (next Sunday)
-	endOfWeek := startOfWeek.AddDate(0, 0, 7)
+	from, to := util.SyncWindow(clock, loc, weekStart, cfg.LookbackDays, cfg.LookaheadDays+7*cfg.LookaheadWeeks)
+	return from.Format(time.RFC3339), to.Format(time.RFC3339), nil
+}
 
-	return startOfWeek.Format(time.RFC3339), endOfWeek.Format(time.RFC3339)
+// countFiltered adds up the events filtered out by every rule
+func countFiltered(filtered map[string]int) int {
+	total := 0
+	for _, count := range filtered {
+		total += count
+	}
+	return total
 }
 
-func printSummary(stats sync.SyncStats, dryRun bool) {
-	log.Printf("Sync completed: %d created, %d updated, %d deleted, %d unchanged",
-		stats.Created, stats.Updated, stats.Deleted, stats.Skipped)
+// newFilter compiles the configured filter rules, or returns nil when there
+// are none and every Pike13 event is synced
+func newFilter(cfg *config.Config) (*filter.Filter, error) {
+	if len(cfg.Filters) == 0 {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", cfg.TimeZone, err)
+	}
+	return filter.New(cfg.Filters, loc)
+}
 
+func printSummary(stats sync.SyncStats, dryRun bool) {
+	log.Printf("Sync completed: %d created, %d updated, %d deleted, %d unchanged, %d failed",
+		stats.Created, stats.Updated, stats.Deleted, stats.Skipped, stats.Failed)
+	
 	if dryRun {
 		fmt.Printf("\n==== SYNC SUMMARY (DRY RUN) ====\n")
 		fmt.Printf("Events that would be created: %d\n", stats.Created)
 		fmt.Printf("Events that would be updated: %d\n", stats.Updated)
 		fmt.Printf("Events that would be deleted: %d\n", stats.Deleted)
+		if stats.Cancelled+stats.Marked > 0 {
+			fmt.Printf("Events that would be cancelled: %d\n", stats.Cancelled)
+			fmt.Printf("Events that would be marked as removed: %d\n", stats.Marked)
+		}
 		fmt.Printf("Events that would be unchanged: %d\n", stats.Skipped)
+		if filtered := countFiltered(stats.Filtered); filtered > 0 {
+			fmt.Printf("Events filtered out: %d (%s)\n", filtered, sync.DescribeFiltered(stats.Filtered))
+		}
+		if stats.Frozen > 0 {
+			fmt.Printf("Past events frozen: %d\n", stats.Frozen)
+		}
+		fmt.Printf("Events edited in Google Calendar: %d\n", len(stats.Conflicts))
 		fmt.Printf("===============================\n")
 		fmt.Println("No changes were made to Google Calendar (dry run mode)")
 	} else {
@@ -163,7 +557,35 @@ func printSummary(stats sync.SyncStats, dryRun bool) {
 		fmt.Printf("Events created: %d\n", stats.Created)
 		fmt.Printf("Events updated: %d\n", stats.Updated)
 		fmt.Printf("Events deleted: %d\n", stats.Deleted)
+		if stats.Cancelled+stats.Marked > 0 {
+			fmt.Printf("Events cancelled: %d\n", stats.Cancelled)
+			fmt.Printf("Events marked as removed: %d\n", stats.Marked)
+		}
 		fmt.Printf("Events unchanged: %d\n", stats.Skipped)
+		if filtered := countFiltered(stats.Filtered); filtered > 0 {
+			fmt.Printf("Events filtered out: %d (%s)\n", filtered, sync.DescribeFiltered(stats.Filtered))
+		}
+		if stats.Frozen > 0 {
+			fmt.Printf("Past events frozen: %d\n", stats.Frozen)
+		}
+		fmt.Printf("Events failed: %d\n", stats.Failed)
+		fmt.Printf("Events edited in Google Calendar: %d\n", len(stats.Conflicts))
 		fmt.Printf("====================\n")
 	}
+	
+	// List events edited by hand and what the conflict policy did with them
+	for _, conflict := range stats.Conflicts {
+		pike13Change := ""
+		if conflict.Pike13Changed {
+			pike13Change = ", Pike13 changed it too"
+		}
+		log.Printf("Event '%s' (Pike13 ID %s) was edited in Google Calendar: %s%s",
+			conflict.Summary, conflict.Pike13ID, conflict.Resolution, pike13Change)
+	}
+	
+	// List mutations that still failed after retries
+	for _, outcome := range stats.Errors() {
+		log.Printf("Failed to %s event '%s' (Pike13 ID %s): %v",
+			outcome.Action, outcome.Summary, outcome.Pike13ID, outcome.Err)
+	}
 }
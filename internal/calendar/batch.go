@@ -0,0 +1,281 @@
+package calendar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// MaxBatchSize is the most requests Google Calendar accepts in one batch
+const MaxBatchSize = 50
+
+// BatchKind is the type of change carried by a batch item
+type BatchKind string
+
+// Batch item kinds
+const (
+	BatchInsert BatchKind = "insert"
+	BatchUpdate BatchKind = "update"
+	BatchDelete BatchKind = "delete"
+)
+
+// BatchOp is one insert, update or delete sent in a batch. Updates write
+// Event over EventID; inserts and deletes use the event itself.
+type BatchOp struct {
+	Kind    BatchKind
+	EventID string
+	Event   *calendar.Event
+}
+
+// BatchResult is the outcome of one batch item, in the same form as the
+// result of the matching single call
+type BatchResult struct {
+	Result Result
+	Err    error
+}
+
+// ExecuteBatch sends ops through the Google Calendar batch endpoint, at most
+// MaxBatchSize per request, and returns one result per op in the same order.
+// Items that fail with a transient error, and every item of a batch that
+// could not be sent at all, are retried as single calls so they get the same
+// retries as CreateEvent, UpdateEvent and DeleteEvent. Inserts of events that
+// already exist are turned into updates, as CreateEvent does.
+func (s *Service) ExecuteBatch(ops []BatchOp) []BatchResult {
+	results := make([]BatchResult, len(ops))
+	for start := 0; start < len(ops); start += MaxBatchSize {
+		end := start + MaxBatchSize
+		if end > len(ops) {
+			end = len(ops)
+		}
+		s.executeBatch(ops[start:end], results[start:end])
+	}
+	return results
+}
+
+// executeBatch sends one batch request and fills in results for its ops
+func (s *Service) executeBatch(ops []BatchOp, results []BatchResult) {
+	responses, err := s.sendBatch(ops)
+	if err != nil {
+		log.Printf("Batch of %d calendar changes failed (%v), sending them one at a time", len(ops), err)
+		for i, op := range ops {
+			results[i] = s.executeSingle(op)
+		}
+		return
+	}
+	
+	for i, op := range ops {
+		resp, ok := responses[i]
+		if !ok {
+			log.Printf("Batch response has no result for '%s', sending it on its own", op.Event.Summary)
+			results[i] = s.executeSingle(op)
+			continue
+		}
+		results[i] = s.batchResult(op, resp)
+	}
+}
+
+// batchResult interprets the response to one batch item
+func (s *Service) batchResult(op BatchOp, resp *http.Response) BatchResult {
+	defer resp.Body.Close()
+	
+	err := googleapi.CheckResponse(resp)
+	switch {
+	case err == nil:
+	case op.Kind == BatchDelete && isGone(err):
+		// Someone else already removed it, which is what we wanted
+		log.Printf("Event already deleted: %s", op.Event.Summary)
+		return BatchResult{Result: ResultDeleted}
+	case op.Kind == BatchInsert && isConflict(err) && op.Event.Id != "":
+		log.Printf("Event '%s' already exists as %s, updating it instead", op.Event.Summary, op.Event.Id)
+		result, err := s.restoreEvent(op.Event)
+		return BatchResult{Result: result, Err: err}
+	case IsRetryable(err):
+		// Retry on its own so the item gets the usual backoff and budget
+		return s.executeSingle(op)
+	default:
+		log.Printf("Error in batched %s of event '%s': %v", op.Kind, op.Event.Summary, err)
+		return BatchResult{Result: ResultFailed, Err: fmt.Errorf("batched %s of event '%s' failed permanently: %w", op.Kind, op.Event.Summary, err)}
+	}
+	
+	switch op.Kind {
+	case BatchInsert:
+		var created calendar.Event
+		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+			return BatchResult{Result: ResultFailed, Err: fmt.Errorf("error decoding created event '%s': %v", op.Event.Summary, err)}
+		}
+		// Hand the assigned ID back so the caller can track the event
+		op.Event.Id = created.Id
+		log.Printf("Created event: %s", op.Event.Summary)
+		return BatchResult{Result: ResultCreated}
+	case BatchUpdate:
+		log.Printf("Updated event: %s", op.Event.Summary)
+		return BatchResult{Result: ResultUpdated}
+	default:
+		log.Printf("Deleted event: %s", op.Event.Summary)
+		return BatchResult{Result: ResultDeleted}
+	}
+}
+
+// executeSingle applies one op with the regular, non-batched calls
+func (s *Service) executeSingle(op BatchOp) BatchResult {
+	var res BatchResult
+	switch op.Kind {
+	case BatchInsert:
+		res.Result, res.Err = s.CreateEvent(op.Event)
+	case BatchUpdate:
+		res.Result, res.Err = s.UpdateEvent(op.EventID, op.Event)
+	case BatchDelete:
+		res.Result, res.Err = s.DeleteEvent(op.Event)
+	default:
+		res.Result, res.Err = ResultFailed, fmt.Errorf("unknown batch operation %q", op.Kind)
+	}
+	return res
+}
+
+// sendBatch posts ops as one multipart/mixed batch request and returns the
+// response to each item, keyed by its position in ops
+func (s *Service) sendBatch(ops []BatchOp) (map[int]*http.Response, error) {
+	base, err := url.Parse(s.calendarService.BasePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar base path: %v", err)
+	}
+	
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for i, op := range ops {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-ID":   {fmt.Sprintf("<item%d>", i)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBatchItem(part, base.Path, s.config.CalendarID, op); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	
+	req, err := http.NewRequest(http.MethodPost, batchURL(base), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+	
+	return readBatchResponse(resp)
+}
+
+// writeBatchItem writes a single HTTP request as the body of a batch part
+func writeBatchItem(w io.Writer, basePath, calendarID string, op BatchOp) error {
+	path := basePath + "calendars/" + url.PathEscape(calendarID) + "/events"
+	
+	var method string
+	var payload []byte
+	switch op.Kind {
+	case BatchInsert:
+		method = http.MethodPost
+		data, err := json.Marshal(op.Event)
+		if err != nil {
+			return fmt.Errorf("error encoding event '%s': %v", op.Event.Summary, err)
+		}
+		payload = data
+	case BatchUpdate:
+		method = http.MethodPatch
+		path += "/" + url.PathEscape(op.EventID)
+		
+		// Only touch the managed fields, as UpdateEvent does
+		data, err := json.Marshal(ManagedPatch(op.Event))
+		if err != nil {
+			return fmt.Errorf("error encoding event '%s': %v", op.Event.Summary, err)
+		}
+		payload = data
+	case BatchDelete:
+		method = http.MethodDelete
+		path += "/" + url.PathEscape(op.Event.Id)
+	default:
+		return fmt.Errorf("unknown batch operation %q", op.Kind)
+	}
+	
+	fmt.Fprintf(w, "%s %s HTTP/1.1\r\n", method, path)
+	if payload != nil {
+		fmt.Fprintf(w, "Content-Type: application/json\r\nContent-Length: %d\r\n", len(payload))
+	}
+	fmt.Fprint(w, "\r\n")
+	_, err := w.Write(payload)
+	return err
+}
+
+// readBatchResponse splits a multipart/mixed batch response into the
+// responses of its items, matched to requests by Content-ID
+func readBatchResponse(resp *http.Response) (map[int]*http.Response, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unexpected batch response type %q", resp.Header.Get("Content-Type"))
+	}
+	
+	responses := make(map[int]*http.Response)
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return responses, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading batch response: %v", err)
+		}
+		
+		// Google answers <itemN> with <response-itemN>
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		index, err := strconv.Atoi(strings.TrimPrefix(id, "response-item"))
+		if err != nil {
+			log.Printf("Ignoring batch response part with unknown Content-ID %q", id)
+			continue
+		}
+		
+		// Read the whole part now; the next part invalidates this one
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("error reading batch response: %v", err)
+		}
+		item, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing batch response item %d: %v", index, err)
+		}
+		responses[index] = item
+	}
+}
+
+// batchURL derives the batch endpoint from the API base path, which is
+// https://www.googleapis.com/calendar/v3/ for the real service
+func batchURL(base *url.URL) string {
+	root := *base
+	root.Path = strings.TrimSuffix(root.Path, "calendar/v3/")
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+	}
+	return root.String() + "batch/calendar/v3"
+}
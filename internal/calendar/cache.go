@@ -0,0 +1,249 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// listingCache is a local copy of the synced events on a calendar together
+// with the Google sync token that lists what changed since it was read
+type listingCache struct {
+	CalendarID string                     `json:"calendar_id"`
+	SyncToken  string                     `json:"sync_token"`
+	UpdatedAt  time.Time                  `json:"updated_at"`
+	Events     map[string]*calendar.Event `json:"events"` // Keyed by Google event ID
+	
+	path string
+}
+
+// loadCache reads the listing cache at path. A missing or unreadable file
+// gives an empty cache, which simply means a full read on this run.
+func loadCache(path, calendarID string) *listingCache {
+	cache := &listingCache{
+		CalendarID: calendarID,
+		Events:     make(map[string]*calendar.Event),
+		path:       path,
+	}
+	
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache
+	}
+	if err == nil {
+		err = json.Unmarshal(data, cache)
+	}
+	if err != nil {
+		log.Printf("Warning: ignoring calendar cache %s: %v", path, err)
+		cache.reset()
+		return cache
+	}
+	
+	// A token is only valid for the calendar it was issued for
+	if cache.CalendarID != calendarID {
+		log.Printf("Calendar cache belongs to calendar %s, reading %s from scratch", cache.CalendarID, calendarID)
+		cache.CalendarID = calendarID
+		cache.reset()
+	}
+	if cache.Events == nil {
+		cache.Events = make(map[string]*calendar.Event)
+	}
+	return cache
+}
+
+// reset drops the cached events and token so the next read is a full one
+func (c *listingCache) reset() {
+	c.SyncToken = ""
+	c.Events = make(map[string]*calendar.Event)
+}
+
+// save writes the cache, replacing the file atomically
+func (c *listingCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %v", err)
+	}
+	
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("error encoding calendar cache: %v", err)
+	}
+	
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing calendar cache: %v", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing calendar cache: %v", err)
+	}
+	return nil
+}
+
+// between returns the cached events overlapping timeMin to timeMax (RFC3339,
+// empty for an open bound) ordered by start time, as a listing would
+func (c *listingCache) between(timeMin, timeMax string) []*calendar.Event {
+	min, minErr := time.Parse(time.RFC3339, timeMin)
+	max, maxErr := time.Parse(time.RFC3339, timeMax)
+	
+	var events []*calendar.Event
+	for _, event := range c.Events {
+		start, end := eventTime(event.Start), eventTime(event.End)
+		if end.IsZero() {
+			end = start
+		}
+		// Google matches events that end after timeMin and start before timeMax
+		if minErr == nil && !end.IsZero() && !end.After(min) {
+			continue
+		}
+		if maxErr == nil && !start.IsZero() && !start.Before(max) {
+			continue
+		}
+		events = append(events, event)
+	}
+	
+	sort.Slice(events, func(i, j int) bool {
+		a, b := eventTime(events[i].Start), eventTime(events[j].Start)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return events[i].Id < events[j].Id
+	})
+	return events
+}
+
+// eventTime parses an event start or end, or returns the zero time
+func eventTime(dt *calendar.EventDateTime) time.Time {
+	if dt == nil {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, dt.DateTime); err == nil {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02", dt.Date); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// isSynced reports whether an event was written by pike13sync
+func isSynced(event *calendar.Event) bool {
+	return event.ExtendedProperties != nil && event.ExtendedProperties.Private[PropertySynced] == "true"
+}
+
+// getExistingEventsIncremental answers GetExistingEvents from the listing
+// cache, first reading only the events changed since the last run. Without a
+// usable sync token, or when Google reports it expired (410 Gone), every
+// event on the calendar is read again.
+func (s *Service) getExistingEventsIncremental(timeMin, timeMax string) ([]*calendar.Event, error) {
+	cache := loadCache(s.config.CalendarCachePath, s.config.CalendarID)
+	
+	if cache.SyncToken != "" {
+		err := s.readChanges(cache)
+		if isGone(err) {
+			log.Printf("Calendar sync token expired, reading all events again")
+			cache.reset()
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if cache.SyncToken == "" {
+		if err := s.readAll(cache); err != nil {
+			return nil, err
+		}
+	}
+	
+	cache.UpdatedAt = time.Now().UTC()
+	if err := cache.save(); err != nil {
+		log.Printf("Warning: could not save calendar cache: %v", err)
+	}
+	
+	events := cache.between(timeMin, timeMax)
+	log.Printf("Found %d existing events in Google Calendar between %s and %s", len(events), timeMin, timeMax)
+	return events, nil
+}
+
+// readAll fills the cache with every synced event on the calendar and
+// stores the token for reading later changes
+func (s *Service) readAll(cache *listingCache) error {
+	cache.reset()
+	token, pages, err := s.listEvents("", func(event *calendar.Event) {
+		if event.Status != "cancelled" && isSynced(event) {
+			cache.Events[event.Id] = event
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("error retrieving existing events (page %d): %v", pages+1, err)
+	}
+	
+	cache.SyncToken = token
+	log.Printf("Read %d synced events from Google Calendar in %d page(s)", len(cache.Events), pages)
+	return nil
+}
+
+// readChanges applies the events changed since the cached sync token.
+// Changed events whose content no longer matches the hash stored when they
+// were synced were edited by someone else and are logged; those inside the
+// sync window are handled by the conflict policy when the plan is made.
+func (s *Service) readChanges(cache *listingCache) error {
+	changed, removed := 0, 0
+	token, pages, err := s.listEvents(cache.SyncToken, func(event *calendar.Event) {
+		if event.Status == "cancelled" || !isSynced(event) {
+			if _, ok := cache.Events[event.Id]; ok {
+				delete(cache.Events, event.Id)
+				removed++
+			}
+			return
+		}
+		
+		changed++
+		cache.Events[event.Id] = event
+		if IsEdited(event) {
+			log.Printf("Warning: synced event '%s' (%s) was edited in Google Calendar", event.Summary, event.Id)
+		}
+	})
+	if err != nil {
+		// An expired token must stay recognizable to the caller
+		if isGone(err) {
+			return err
+		}
+		return fmt.Errorf("error retrieving changed events (page %d): %v", pages+1, err)
+	}
+	
+	cache.SyncToken = token
+	log.Printf("Read %d changed and %d removed synced events from Google Calendar since %s",
+		changed, removed, cache.UpdatedAt.Local().Format(time.RFC1123))
+	return nil
+}
+
+// listEvents pages through the calendar, from the start or from a sync
+// token, and returns the token for the next incremental read. Sync tokens
+// cannot be combined with time or property filters, so the whole calendar
+// is listed and filtered locally.
+func (s *Service) listEvents(syncToken string, visit func(*calendar.Event)) (string, int, error) {
+	call := s.calendarService.Events.List(s.config.CalendarID).SingleEvents(true)
+	if syncToken != "" {
+		call = call.SyncToken(syncToken)
+	}
+	if s.config.CalendarMaxResults > 0 {
+		call = call.MaxResults(int64(s.config.CalendarMaxResults))
+	}
+	
+	nextToken := ""
+	pages := 0
+	err := call.Pages(context.Background(), func(events *calendar.Events) error {
+		pages++
+		for _, event := range events.Items {
+			visit(event)
+		}
+		nextToken = events.NextSyncToken
+		return nil
+	})
+	return nextToken, pages, err
+}
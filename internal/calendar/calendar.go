@@ -5,119 +5,124 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"time"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	
 	"github.com/dcotelessa/pike13sync/internal/config"
 	"github.com/dcotelessa/pike13sync/internal/pike13"
-	"github.com/dcotelessa/pike13sync/internal/util"
 )
 
 // Service handles interactions with Google Calendar
 type Service struct {
 	calendarService *calendar.Service
 	config          *config.Config
+	retrier         *retrier
+	httpClient      *http.Client // Authenticated client, used for batch requests
+	templates       *Templates   // Renders event titles, descriptions and locations
+	colors          *ColorRules  // Picks event colors
 }
 
 // NewService creates a new calendar service
 func NewService(config *config.Config) (*Service, error) {
 	ctx := context.Background()
 	
-	// Set up Google Calendar service
-	calendarService, err := setupGoogleCalendar(ctx, config.CredentialsPath)
+	// Set up an authenticated Google Calendar client
+	client, err := setupGoogleCalendar(ctx, config.CredentialsPath)
 	if err != nil {
 		return nil, err
 	}
 	
-	return &Service{
-		calendarService: calendarService,
-		config:          config,
-	}, nil
+	return NewServiceWithOptions(config, option.WithHTTPClient(client))
 }
 
-// GetExistingEvents retrieves events from Google Calendar
-func (s *Service) GetExistingEvents() ([]*calendar.Event, error) {
-	// Get events from the past week and the next two weeks
-	timeMin := time.Now().AddDate(0, 0, -7).Format(time.RFC3339)
-	timeMax := time.Now().AddDate(0, 0, 14).Format(time.RFC3339)
+// NewServiceWithOptions creates a calendar service from explicit client options,
+// e.g. a custom endpoint and HTTP client when talking to a fake Calendar API
+func NewServiceWithOptions(config *config.Config, opts ...option.ClientOption) (*Service, error) {
+	ctx := context.Background()
 	
-	events, err := s.calendarService.Events.List(s.config.CalendarID).
-		TimeMin(timeMin).
-		TimeMax(timeMax).
-		SingleEvents(true).
-		OrderBy("startTime").
-		Do()
+	calendarService, err := calendar.NewService(ctx, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("error retrieving existing events: %v", err)
+		return nil, fmt.Errorf("unable to create calendar service: %v", err)
 	}
 	
-	return events.Items, nil
-}
-
-// FormatEventData creates a Google Calendar event from Pike13 event data
-func (s *Service) FormatEventData(pike13Event pike13.Pike13Event) *calendar.Event {
-	// Format description
-	description := ""
-	if pike13Event.Description != "" {
-		description += pike13Event.Description + "\n\n"
+	// Batch requests bypass the generated client, so keep the HTTP client it uses
+	httpClient, _, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create calendar HTTP client: %v", err)
 	}
 	
-	// Add status information
-	status := "Active"
-	if pike13Event.State != "active" {
-		status = "Cancelled"
+	templates, err := NewTemplates(config)
+	if err != nil {
+		return nil, err
 	}
-	description += fmt.Sprintf("Status: %s\n", status)
-	
-	// Add capacity information
-	capacityInfo := fmt.Sprintf("Spaces available: %d", pike13Event.CapacityRemaining)
-	if pike13Event.Full {
-		capacityInfo = "Class is FULL"
+	colors, err := NewColorRules(config)
+	if err != nil {
+		return nil, err
 	}
-	description += fmt.Sprintf("Capacity: %s\n", capacityInfo)
 	
-	// Add waitlist info
-	waitlistInfo := "Waitlist is OPEN"
-	if pike13Event.Waitlist.Full {
-		waitlistInfo = "Waitlist is FULL"
+	return &Service{
+		calendarService: calendarService,
+		config:          config,
+		retrier:         newRetrier(config.CalendarRetry, config.CalendarRetryBudget),
+		httpClient:      httpClient,
+		templates:       templates,
+		colors:          colors,
+	}, nil
+}
+
+// GetExistingEvents retrieves events from Google Calendar between timeMin and
+// timeMax (RFC3339), which should match the range fetched from Pike13
+func (s *Service) GetExistingEvents(timeMin, timeMax string) ([]*calendar.Event, error) {
+	if s.config.IncrementalSync && s.config.CalendarCachePath != "" {
+		return s.getExistingEventsIncremental(timeMin, timeMax)
 	}
-	description += fmt.Sprintf("Waitlist: %s\n", waitlistInfo)
 	
-	// Add staff members
-	var staffNames []string
-	for _, staff := range pike13Event.StaffMembers {
-		staffNames = append(staffNames, staff.Name)
-	}
-	if len(staffNames) > 0 {
-		description += "Instructor(s): "
-		for i, name := range staffNames {
-			if i > 0 {
-				description += ", "
-			}
-			description += name
-		}
-		description += "\n"
+	call := s.calendarService.Events.List(s.config.CalendarID).
+		TimeMin(timeMin).
+		TimeMax(timeMax).
+		SingleEvents(true).
+		OrderBy("startTime").
+		// Only list events this tool owns so shared calendars stay untouched
+		PrivateExtendedProperty(PropertySynced + "=true")
+	if s.config.CalendarMaxResults > 0 {
+		call = call.MaxResults(int64(s.config.CalendarMaxResults))
 	}
 	
-	// Determine color based on state
-	colorId := "11" // Red for active
-	if pike13Event.State != "active" {
-		colorId = "8" // Gray for cancelled
+	// Follow every page; missing a page would make its events look new
+	var items []*calendar.Event
+	pages := 0
+	err := call.Pages(context.Background(), func(events *calendar.Events) error {
+		pages++
+		items = append(items, events.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving existing events (page %d): %v", pages+1, err)
 	}
 	
+	log.Printf("Retrieved %d existing events from Google Calendar in %d page(s)", len(items), pages)
+	return items, nil
+}
+
+// FormatEventData creates a Google Calendar event from Pike13 event data.
+// The title, description and location come from the configured templates,
+// and the color from the color rules.
+func (s *Service) FormatEventData(pike13Event pike13.Pike13Event) *calendar.Event {
 	// Convert ID to string for extended properties
 	pike13IDStr := strconv.Itoa(pike13Event.ID)
 	
 	// Create the event object
 	event := &calendar.Event{
-		Summary:     pike13Event.Name,
-		Description: description,
+		Id:          EventIDFor(s.config, pike13IDStr),
+		Summary:     s.templates.Summary(pike13Event),
+		Description: s.templates.Description(pike13Event),
 		Start: &calendar.EventDateTime{
 			DateTime: pike13Event.StartAt,
 			TimeZone: s.config.TimeZone,
@@ -126,114 +131,113 @@ func (s *Service) FormatEventData(pike13Event pike13.Pike13Event) *calendar.Even
 			DateTime: pike13Event.EndAt,
 			TimeZone: s.config.TimeZone,
 		},
-		ColorId: colorId,
+		ColorId: s.colors.ColorFor(pike13Event),
 		Source: &calendar.EventSource{
 			Title: "View on Pike13",
 			Url:   pike13Event.URL,
 		},
 		ExtendedProperties: &calendar.EventExtendedProperties{
 			Private: map[string]string{
-				"pike13_id":   pike13IDStr,
-				"pike13_sync": "true",
+				PropertyPike13ID: pike13IDStr,
+				PropertySynced:   "true",
 			},
 		},
 	}
 	
+	// Only write locations when a location template is configured
+	if location, ok := s.templates.Location(pike13Event); ok {
+		event.Location = location
+		event.ExtendedProperties.Private[PropertyLocation] = "true"
+	}
+	
+	// Tag the event with the deployment that owns it
+	if s.config.InstanceID != "" {
+		event.ExtendedProperties.Private[PropertyInstance] = s.config.InstanceID
+	}
+	
+	// Record what was written so later runs can tell whether Pike13 changed
+	event.ExtendedProperties.Private[PropertyHash] = ContentHash(event)
+	
 	return event
 }
 
-// CreateEvent creates a new event in Google Calendar
-func (s *Service) CreateEvent(event *calendar.Event) {
-	if s.config.DryRun {
-		fmt.Printf("Would CREATE: %s (%s to %s)\n", 
-			event.Summary, 
-			util.FormatDateTime(event.Start.DateTime), 
-			util.FormatDateTime(event.End.DateTime))
-		return
+// CreateEvent creates a new event in Google Calendar. On success the event's
+// Id is set to the one Google assigned.
+// Events with a deterministic ID that already exist, for example because an
+// earlier run crashed after inserting them or because they were deleted and
+// are kept as cancelled, are updated in place instead.
+func (s *Service) CreateEvent(event *calendar.Event) (Result, error) {
+	var created *calendar.Event
+	err := s.retrier.do(fmt.Sprintf("Creating event '%s'", event.Summary), func() error {
+		var err error
+		created, err = s.calendarService.Events.Insert(s.config.CalendarID, event).Do()
+		return err
+	})
+	if isConflict(err) && event.Id != "" {
+		log.Printf("Event '%s' already exists as %s, updating it instead", event.Summary, event.Id)
+		return s.restoreEvent(event)
 	}
-	
-	_, err := s.calendarService.Events.Insert(s.config.CalendarID, event).Do()
 	if err != nil {
 		log.Printf("Error creating event '%s': %v", event.Summary, err)
-		return
+		return ResultFailed, err
 	}
+	
+	// Hand the assigned ID back so the caller can track the event
+	event.Id = created.Id
 	log.Printf("Created event: %s", event.Summary)
+	return ResultCreated, nil
 }
 
-// UpdateEvent updates an existing event in Google Calendar
-func (s *Service) UpdateEvent(existingEvent *calendar.Event, newEventData *calendar.Event) string {
-	// Check if update is needed by comparing key fields
-	needsUpdate := false
-	
-	if existingEvent.Summary != newEventData.Summary {
-		needsUpdate = true
-	}
-	if existingEvent.Description != newEventData.Description {
-		needsUpdate = true
-	}
-	if existingEvent.Start.DateTime != newEventData.Start.DateTime {
-		needsUpdate = true
-	}
-	if existingEvent.End.DateTime != newEventData.End.DateTime {
-		needsUpdate = true
-	}
-	if existingEvent.ColorId != newEventData.ColorId {
-		needsUpdate = true
+// UpdateEvent patches the managed fields of an existing Google Calendar event
+// with new event data. Attendees, reminders, location, attachments and any
+// other fields or properties added by people or other tools are kept.
+// Deciding whether an update is needed is up to the caller.
+func (s *Service) UpdateEvent(eventID string, event *calendar.Event) (Result, error) {
+	err := s.retrier.do(fmt.Sprintf("Updating event '%s'", event.Summary), func() error {
+		_, err := s.calendarService.Events.Patch(s.config.CalendarID, eventID, ManagedPatch(event)).Do()
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating event '%s': %v", event.Summary, err)
+		return ResultFailed, err
 	}
+	log.Printf("Updated event: %s", event.Summary)
+	return ResultUpdated, nil
+}
+
+// restoreEvent overwrites an existing event that has the same ID as a new one,
+// marking it confirmed again in case it had been deleted
+func (s *Service) restoreEvent(event *calendar.Event) (Result, error) {
+	restored := *event
+	restored.Status = "confirmed"
 	
-	// Only update if changes detected
-	if needsUpdate {
-		if s.config.DryRun {
-			fmt.Printf("Would UPDATE: %s (%s to %s)\n", 
-				newEventData.Summary, 
-				util.FormatDateTime(newEventData.Start.DateTime), 
-				util.FormatDateTime(newEventData.End.DateTime))
-			return "updated"
-		}
-		
-		// Preserve the Google Calendar event ID
-		newEventData.Id = existingEvent.Id
-		
-		_, err := s.calendarService.Events.Update(s.config.CalendarID, existingEvent.Id, newEventData).Do()
-		if err != nil {
-			log.Printf("Error updating event '%s': %v", newEventData.Summary, err)
-			return "error"
-		}
-		log.Printf("Updated event: %s", newEventData.Summary)
-		return "updated"
-	} else {
-		if s.config.DryRun {
-			fmt.Printf("Would SKIP (no changes): %s (%s to %s)\n", 
-				existingEvent.Summary, 
-				util.FormatDateTime(existingEvent.Start.DateTime), 
-				util.FormatDateTime(existingEvent.End.DateTime))
-		} else {
-			log.Printf("No changes needed for event: %s", existingEvent.Summary)
-		}
-		return "unchanged"
+	result, err := s.UpdateEvent(event.Id, &restored)
+	if err != nil {
+		return result, err
 	}
+	return ResultCreated, nil
 }
 
 // DeleteEvent deletes an event from Google Calendar
-func (s *Service) DeleteEvent(event *calendar.Event) {
-	if s.config.DryRun {
-		fmt.Printf("Would DELETE: %s (%s to %s)\n", 
-			event.Summary, 
-			util.FormatDateTime(event.Start.DateTime), 
-			util.FormatDateTime(event.End.DateTime))
-		return
+func (s *Service) DeleteEvent(event *calendar.Event) (Result, error) {
+	err := s.retrier.do(fmt.Sprintf("Deleting event '%s'", event.Summary), func() error {
+		return s.calendarService.Events.Delete(s.config.CalendarID, event.Id).Do()
+	})
+	if isGone(err) {
+		// Someone else already removed it, which is what we wanted
+		log.Printf("Event already deleted: %s", event.Summary)
+		return ResultDeleted, nil
 	}
-	
-	err := s.calendarService.Events.Delete(s.config.CalendarID, event.Id).Do()
 	if err != nil {
 		log.Printf("Error deleting event '%s': %v", event.Summary, err)
-		return
+		return ResultFailed, err
 	}
 	log.Printf("Deleted event: %s", event.Summary)
+	return ResultDeleted, nil
 }
 
-// setupGoogleCalendar creates a Google Calendar service
-func setupGoogleCalendar(ctx context.Context, credentialsPath string) (*calendar.Service, error) {
+// setupGoogleCalendar creates an HTTP client authenticated for Google Calendar
+func setupGoogleCalendar(ctx context.Context, credentialsPath string) (*http.Client, error) {
 	var credBytes []byte
 	var err error
 	
@@ -273,11 +277,5 @@ func setupGoogleCalendar(ctx context.Context, credentialsPath string) (*calendar
 		return nil, fmt.Errorf("unable to parse credentials: %v", err)
 	}
 	
-	client := config.Client(ctx)
-	srv, err := calendar.NewService(ctx, option.WithHTTPClient(client))
-	if err != nil {
-		return nil, fmt.Errorf("unable to create calendar service: %v", err)
-	}
-	
-	return srv, nil
+	return config.Client(ctx), nil
 }
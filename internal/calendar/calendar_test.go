@@ -0,0 +1,1039 @@
+package calendar_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcalendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+)
+
+// fakeFailure is an API error the fake returns instead of handling a mutation
+type fakeFailure struct {
+	status int
+	reason string
+}
+
+// fakeCalendar is a minimal in-memory Google Calendar API server
+type fakeCalendar struct {
+	mu       sync.Mutex
+	events   []*calendar.Event
+	requests []*http.Request
+	failures []fakeFailure // Consumed in order by mutation requests
+	nextID   int
+	
+	// Sync tokens are the change sequence number at the time of listing
+	seq          int
+	changedAt    map[string]int
+	expireTokens bool // Reject the next sync token with 410 Gone
+}
+
+// ServeHTTP handles event listing with page tokens and event mutations
+func (f *fakeCalendar) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+	
+	if r.URL.Path == "/batch/calendar/v3" {
+		f.batch(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		f.mutate(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/events") {
+		http.Error(w, "unsupported request", http.StatusNotFound)
+		return
+	}
+	
+	// Page size comes from maxResults; the page token is simply the next offset
+	pageSize := 250
+	if maxResults := r.URL.Query().Get("maxResults"); maxResults != "" {
+		pageSize, _ = strconv.Atoi(maxResults)
+	}
+	offset := 0
+	if token := r.URL.Query().Get("pageToken"); token != "" {
+		offset, _ = strconv.Atoi(token)
+	}
+	
+	// With a sync token only events changed since then are listed,
+	// including deleted ones, and filters are not allowed
+	syncToken := r.URL.Query().Get("syncToken")
+	if syncToken != "" {
+		if r.URL.Query().Get("timeMin") != "" || r.URL.Query().Get("privateExtendedProperty") != "" {
+			writeAPIError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+		if f.expireTokens {
+			f.expireTokens = false
+			writeAPIError(w, http.StatusGone, "fullSyncRequired")
+			return
+		}
+	}
+	since, _ := strconv.Atoi(syncToken)
+	
+	// Apply privateExtendedProperty filters the way the real API does
+	// Deleted events are kept as cancelled and hidden from listings
+	var matching []*calendar.Event
+	for _, event := range f.events {
+		if syncToken != "" {
+			if f.changedAt[event.Id] > since {
+				matching = append(matching, event)
+			}
+			continue
+		}
+		if event.Status == "cancelled" {
+			continue
+		}
+		if matchesPrivateProperties(event, r.URL.Query()["privateExtendedProperty"]) {
+			matching = append(matching, event)
+		}
+	}
+	
+	end := offset + pageSize
+	if end > len(matching) {
+		end = len(matching)
+	}
+	response := map[string]interface{}{
+		"items": matching[offset:end],
+	}
+	if end < len(matching) {
+		response["nextPageToken"] = strconv.Itoa(end)
+	} else {
+		response["nextSyncToken"] = strconv.Itoa(f.seq)
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// mutate handles inserts, updates and deletes, failing first if a failure is queued
+func (f *fakeCalendar) mutate(w http.ResponseWriter, r *http.Request) {
+	if len(f.failures) > 0 {
+		failure := f.failures[0]
+		f.failures = f.failures[1:]
+		writeAPIError(w, failure.status, failure.reason)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	eventID := ""
+	if parts := strings.SplitN(r.URL.Path, "/events/", 2); len(parts) == 2 {
+		eventID = parts[1]
+	}
+	
+	switch {
+	case r.Method == http.MethodPost && eventID == "":
+		var event calendar.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		if event.Id == "" {
+			f.nextID++
+			event.Id = fmt.Sprintf("created%d", f.nextID)
+		}
+		if f.indexOf(event.Id) >= 0 {
+			writeAPIError(w, http.StatusConflict, "duplicate")
+			return
+		}
+		f.events = append(f.events, &event)
+		f.touch(event.Id)
+		json.NewEncoder(w).Encode(&event)
+	case r.Method == http.MethodPut:
+		index := f.indexOf(eventID)
+		if index < 0 {
+			writeAPIError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		var event calendar.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		event.Id = eventID
+		f.events[index] = &event
+		f.touch(eventID)
+		json.NewEncoder(w).Encode(&event)
+	case r.Method == http.MethodPatch:
+		index := f.indexOf(eventID)
+		if index < 0 {
+			writeAPIError(w, http.StatusNotFound, "notFound")
+			return
+		}
+		// Decoding over a copy merges fields, nested objects and maps like a patch
+		patched := copyEvent(f.events[index])
+		json.NewDecoder(r.Body).Decode(patched)
+		patched.Id = eventID
+		f.events[index] = patched
+		f.touch(eventID)
+		json.NewEncoder(w).Encode(patched)
+	case r.Method == http.MethodDelete:
+		index := f.indexOf(eventID)
+		if index < 0 || f.events[index].Status == "cancelled" {
+			writeAPIError(w, http.StatusGone, "deleted")
+			return
+		}
+		f.events[index].Status = "cancelled"
+		f.touch(eventID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported request", http.StatusNotFound)
+	}
+}
+
+// batch answers a multipart/mixed batch request by running every part
+// through mutate, so queued failures hit individual items
+func (f *fakeCalendar) batch(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, "bad batch content type", http.StatusBadRequest)
+		return
+	}
+	
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "bad batch body", http.StatusBadRequest)
+			return
+		}
+		inner, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			http.Error(w, "bad batch item", http.StatusBadRequest)
+			return
+		}
+		
+		recorder := httptest.NewRecorder()
+		f.mutate(recorder, inner)
+		
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		out, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/http"},
+			"Content-ID":   {"<response-" + id + ">"},
+		})
+		recorder.Result().Write(out)
+	}
+	writer.Close()
+	
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	w.Write(body.Bytes())
+}
+
+// copyEvent deep-copies an event through JSON
+func copyEvent(event *calendar.Event) *calendar.Event {
+	data, _ := json.Marshal(event)
+	var copied calendar.Event
+	json.Unmarshal(data, &copied)
+	return &copied
+}
+
+// touch records that an event changed, for listings with a sync token
+func (f *fakeCalendar) touch(eventID string) {
+	if f.changedAt == nil {
+		f.changedAt = make(map[string]int)
+	}
+	f.seq++
+	f.changedAt[eventID] = f.seq
+}
+
+// indexOf returns the position of an event by ID, or -1
+func (f *fakeCalendar) indexOf(eventID string) int {
+	for i, event := range f.events {
+		if event.Id == eventID {
+			return i
+		}
+	}
+	return -1
+}
+
+// mutationCount returns how many non-GET requests the fake received
+func (f *fakeCalendar) mutationCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, r := range f.requests {
+		if r.Method != http.MethodGet {
+			count++
+		}
+	}
+	return count
+}
+
+// writeAPIError writes an error body in the Google API format
+func writeAPIError(w http.ResponseWriter, status int, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": "%s", "errors": [{"reason": "%s", "message": "%s"}]}}`,
+		status, reason, reason, reason)
+}
+
+// matchesPrivateProperties reports whether an event carries every key=value filter
+func matchesPrivateProperties(event *calendar.Event, filters []string) bool {
+	for _, filter := range filters {
+		key, value, _ := strings.Cut(filter, "=")
+		if event.ExtendedProperties == nil || event.ExtendedProperties.Private[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// syncedEvent builds a calendar event carrying the Pike13 sync properties
+func syncedEvent(id, pike13ID string) *calendar.Event {
+	return &calendar.Event{
+		Id:      id,
+		Summary: "Class " + pike13ID,
+		ExtendedProperties: &calendar.ExtendedProperties{
+			Private: map[string]string{
+				calendar.PropertyPike13ID: pike13ID,
+				calendar.PropertySynced:   "true",
+			},
+		},
+	}
+}
+
+// newTestService starts a fake calendar server and returns a service bound to it
+func newTestService(t *testing.T, fake *fakeCalendar, cfg *config.Config) *calendar.Service {
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+	
+	service, err := calendar.NewServiceWithOptions(cfg,
+		option.WithEndpoint(ts.URL+"/"),
+		option.WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatalf("NewServiceWithOptions returned error: %v", err)
+	}
+	return service
+}
+
+// TestGetExistingEventsPagination verifies that every listing page is followed
+func TestGetExistingEventsPagination(t *testing.T) {
+	fake := &fakeCalendar{}
+	for i := 1; i <= 7; i++ {
+		fake.events = append(fake.events, syncedEvent(fmt.Sprintf("event%d", i), strconv.Itoa(i)))
+	}
+	
+	cfg := &config.Config{CalendarID: "test_calendar", CalendarMaxResults: 3}
+	service := newTestService(t, fake, cfg)
+	
+	events, err := service.GetExistingEvents("2025-05-11T00:00:00Z", "2025-05-18T00:00:00Z")
+	if err != nil {
+		t.Fatalf("GetExistingEvents returned error: %v", err)
+	}
+	
+	if len(events) != 7 {
+		t.Fatalf("Expected 7 events across all pages, got %d", len(events))
+	}
+	for i, event := range events {
+		if expected := fmt.Sprintf("event%d", i+1); event.Id != expected {
+			t.Errorf("Expected event %d to be %s, got %s", i, expected, event.Id)
+		}
+	}
+	
+	// 7 events with 3 per page means 3 requests
+	if len(fake.requests) != 3 {
+		t.Errorf("Expected 3 list requests, got %d", len(fake.requests))
+	}
+	for _, r := range fake.requests {
+		query := r.URL.Query()
+		if query.Get("maxResults") != "3" {
+			t.Errorf("Expected maxResults=3, got %s", query.Get("maxResults"))
+		}
+		if query.Get("timeMin") != "2025-05-11T00:00:00Z" || query.Get("timeMax") != "2025-05-18T00:00:00Z" {
+			t.Errorf("Unexpected listing window: %s - %s", query.Get("timeMin"), query.Get("timeMax"))
+		}
+	}
+}
+
+// TestGetExistingEventsError verifies that a failing page fails the whole listing
+func TestGetExistingEventsError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageToken") != "" {
+			http.Error(w, `{"error": {"code": 400, "message": "bad page"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [{"id": "event1"}], "nextPageToken": "next"}`))
+	}))
+	defer ts.Close()
+	
+	cfg := &config.Config{CalendarID: "test_calendar"}
+	service, err := calendar.NewServiceWithOptions(cfg,
+		option.WithEndpoint(ts.URL+"/"),
+		option.WithHTTPClient(ts.Client()))
+	if err != nil {
+		t.Fatalf("NewServiceWithOptions returned error: %v", err)
+	}
+	
+	events, err := service.GetExistingEvents("2025-05-11T00:00:00Z", "2025-05-18T00:00:00Z")
+	if err == nil {
+		t.Fatal("Expected error when a page fails, got nil")
+	}
+	if events != nil {
+		t.Errorf("Expected no partial results, got %d events", len(events))
+	}
+}
+
+// TestGetExistingEventsOwnedOnly verifies that only events owned by pike13sync are listed
+func TestGetExistingEventsOwnedOnly(t *testing.T) {
+	fake := &fakeCalendar{
+		events: []*calendar.Event{
+			syncedEvent("synced1", "1"),
+			{Id: "meeting", Summary: "Staff Meeting"},
+			{
+				Id:      "other",
+				Summary: "Other Integration",
+				ExtendedProperties: &calendar.ExtendedProperties{
+					Private: map[string]string{"pike13_id": "2"},
+				},
+			},
+			syncedEvent("synced2", "3"),
+		},
+	}
+	
+	cfg := &config.Config{CalendarID: "test_calendar"}
+	service := newTestService(t, fake, cfg)
+	
+	events, err := service.GetExistingEvents("2025-05-11T00:00:00Z", "2025-05-18T00:00:00Z")
+	if err != nil {
+		t.Fatalf("GetExistingEvents returned error: %v", err)
+	}
+	
+	filter := fake.requests[0].URL.Query()["privateExtendedProperty"]
+	if len(filter) != 1 || filter[0] != "pike13_sync=true" {
+		t.Errorf("Expected privateExtendedProperty=pike13_sync=true, got %v", filter)
+	}
+	if len(events) != 2 || events[0].Id != "synced1" || events[1].Id != "synced2" {
+		t.Errorf("Expected only the two synced events, got %d events", len(events))
+	}
+}
+
+// fastRetry keeps retry tests quick
+var fastRetry = config.RetryConfig{
+	MaxAttempts: 3,
+	BaseDelay:   config.Duration{Duration: time.Millisecond},
+	MaxDelay:    config.Duration{Duration: 5 * time.Millisecond},
+}
+
+// testEvent builds an event ready to be written to the fake calendar
+func testEvent(summary string) *calendar.Event {
+	return &calendar.Event{
+		Summary: summary,
+		Start:   &calendar.EventDateTime{DateTime: "2025-05-15T14:00:00Z"},
+		End:     &calendar.EventDateTime{DateTime: "2025-05-15T15:00:00Z"},
+	}
+}
+
+// TestIsRetryable tests classification of Google API errors
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Nil error", nil, false},
+		{"Network error", errors.New("connection reset"), true},
+		{"Rate limited 403", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{"User rate limited 403", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "userRateLimitExceeded"}}}, true},
+		{"Forbidden 403", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}, false},
+		{"Too many requests", &googleapi.Error{Code: 429}, true},
+		{"Backend error", &googleapi.Error{Code: 500, Errors: []googleapi.ErrorItem{{Reason: "backendError"}}}, true},
+		{"Service unavailable", &googleapi.Error{Code: 503}, true},
+		{"Bad request", &googleapi.Error{Code: 400}, false},
+		{"Not found", &googleapi.Error{Code: 404}, false},
+		{"Wrapped rate limit", fmt.Errorf("insert: %w", &googleapi.Error{Code: 429}), true},
+	}
+	
+	for _, tc := range testCases {
+		if result := calendar.IsRetryable(tc.err); result != tc.expected {
+			t.Errorf("%s: expected IsRetryable=%v, got %v", tc.name, tc.expected, result)
+		}
+	}
+}
+
+// TestMutationRetries tests that calendar mutations retry transient errors only
+func TestMutationRetries(t *testing.T) {
+	testCases := []struct {
+		name              string
+		failures          []fakeFailure
+		budget            int
+		expectError       bool
+		expectedMutations int
+	}{
+		{
+			name:              "Recovers from rate limiting",
+			failures:          []fakeFailure{{403, "rateLimitExceeded"}, {500, "backendError"}},
+			budget:            10,
+			expectedMutations: 3,
+		},
+		{
+			name:              "Gives up after max attempts",
+			failures:          []fakeFailure{{503, "backendError"}, {503, "backendError"}, {503, "backendError"}},
+			budget:            10,
+			expectError:       true,
+			expectedMutations: 3,
+		},
+		{
+			name:              "Permanent error is not retried",
+			failures:          []fakeFailure{{403, "forbidden"}},
+			budget:            10,
+			expectError:       true,
+			expectedMutations: 1,
+		},
+		{
+			name:              "Retry budget exhausted",
+			failures:          []fakeFailure{{429, "rateLimitExceeded"}, {429, "rateLimitExceeded"}},
+			budget:            1,
+			expectError:       true,
+			expectedMutations: 2,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeCalendar{failures: tc.failures}
+			cfg := &config.Config{
+				CalendarID:          "test_calendar",
+				CalendarRetry:       fastRetry,
+				CalendarRetryBudget: tc.budget,
+			}
+			service := newTestService(t, fake, cfg)
+			
+			event := testEvent("Retry Class")
+			result, err := service.CreateEvent(event)
+			if tc.expectError && result != calendar.ResultFailed {
+				t.Errorf("Expected result %s, got %s", calendar.ResultFailed, result)
+			}
+			if !tc.expectError && result != calendar.ResultCreated {
+				t.Errorf("Expected result %s, got %s", calendar.ResultCreated, result)
+			}
+			if tc.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("Expected success, got %v", err)
+			}
+			if !tc.expectError && event.Id == "" {
+				t.Error("Expected the created event ID to be set on the event")
+			}
+			if mutations := fake.mutationCount(); mutations != tc.expectedMutations {
+				t.Errorf("Expected %d insert requests, got %d", tc.expectedMutations, mutations)
+			}
+		})
+	}
+}
+
+// TestRetryBudgetSharedAcrossMutations tests that the budget limits retries for the whole run
+func TestRetryBudgetSharedAcrossMutations(t *testing.T) {
+	fake := &fakeCalendar{
+		failures: []fakeFailure{{503, "backendError"}, {503, "backendError"}, {503, "backendError"}},
+	}
+	cfg := &config.Config{
+		CalendarID:          "test_calendar",
+		CalendarRetry:       fastRetry,
+		CalendarRetryBudget: 1,
+	}
+	service := newTestService(t, fake, cfg)
+	
+	// The first create uses the only retry and still fails
+	if _, err := service.CreateEvent(testEvent("First")); err == nil {
+		t.Error("Expected first create to fail")
+	}
+	// The second create gets no retries left
+	if _, err := service.CreateEvent(testEvent("Second")); err == nil {
+		t.Error("Expected second create to fail without retrying")
+	}
+	if mutations := fake.mutationCount(); mutations != 3 {
+		t.Errorf("Expected 3 insert requests, got %d", mutations)
+	}
+}
+
+// TestDeleteEventAlreadyGone tests that deleting an event that no longer exists counts as deleted
+func TestDeleteEventAlreadyGone(t *testing.T) {
+	fake := &fakeCalendar{}
+	cfg := &config.Config{CalendarID: "test_calendar"}
+	service := newTestService(t, fake, cfg)
+	
+	event := testEvent("Gone Class")
+	event.Id = "missing"
+	result, err := service.DeleteEvent(event)
+	if err != nil {
+		t.Fatalf("Expected no error for an already deleted event, got %v", err)
+	}
+	if result != calendar.ResultDeleted {
+		t.Errorf("Expected result %s, got %s", calendar.ResultDeleted, result)
+	}
+}
+
+// TestContentHash tests which changes alter an event's content hash
+func TestContentHash(t *testing.T) {
+	base := func() *calendar.Event {
+		event := testEvent("Hash Class")
+		event.Start.TimeZone = "America/Los_Angeles"
+		event.Source = &calendar.EventSource{Title: "View on Pike13", Url: "https://example.pike13.com/e/1"}
+		return event
+	}
+	hash := calendar.ContentHash(base())
+	
+	testCases := []struct {
+		name    string
+		modify  func(*calendar.Event)
+		changed bool
+	}{
+		{"Same instant in another offset", func(e *calendar.Event) { e.Start.DateTime = "2025-05-15T07:00:00-07:00" }, false},
+		{"Extended properties", func(e *calendar.Event) {
+			e.ExtendedProperties = &calendar.ExtendedProperties{Private: map[string]string{calendar.PropertyHash: "old"}}
+		}, false},
+		{"Source URL", func(e *calendar.Event) { e.Source.Url = "https://example.pike13.com/e/2" }, true},
+		{"Time zone", func(e *calendar.Event) { e.Start.TimeZone = "America/New_York" }, true},
+		{"Start time", func(e *calendar.Event) { e.Start.DateTime = "2025-05-15T14:30:00Z" }, true},
+		{"Unmanaged location", func(e *calendar.Event) { e.Location = "Studio B" }, false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			event := base()
+			tc.modify(event)
+			if changed := calendar.ContentHash(event) != hash; changed != tc.changed {
+				t.Errorf("Expected changed=%v, got %v", tc.changed, changed)
+			}
+		})
+	}
+}
+
+// TestFormatEventDataStoresHash tests that formatted events carry their content hash
+func TestFormatEventDataStoresHash(t *testing.T) {
+	service := newTestService(t, &fakeCalendar{}, &config.Config{CalendarID: "test_calendar", TimeZone: "America/Los_Angeles"})
+	
+	event := service.FormatEventData(pike13.Pike13Event{
+		ID:      42,
+		Name:    "Hashed Class",
+		StartAt: "2025-05-15T14:00:00Z",
+		EndAt:   "2025-05-15T15:00:00Z",
+		URL:     "https://example.pike13.com/e/42",
+		State:   "active",
+	})
+	
+	stored := calendar.StoredHash(event)
+	if stored == "" {
+		t.Fatal("Expected a stored content hash")
+	}
+	if stored != calendar.ContentHash(event) {
+		t.Errorf("Stored hash %s does not match content hash %s", stored, calendar.ContentHash(event))
+	}
+}
+
+// TestEventID tests that event IDs are stable, namespaced and valid for Google
+func TestEventID(t *testing.T) {
+	id := calendar.EventID("pike13sync", "12345")
+	if id != calendar.EventID("pike13sync", "12345") {
+		t.Error("Expected the same ID for the same occurrence")
+	}
+	if id == calendar.EventID("pike13sync", "12346") || id == calendar.EventID("other", "12345") {
+		t.Error("Expected different IDs for different occurrences or namespaces")
+	}
+	if len(id) < 5 || strings.Trim(id, "0123456789abcdefghijklmnopqrstuv") != "" {
+		t.Errorf("ID %q is not a valid Google event ID", id)
+	}
+	if calendar.EventID("", "12345") != "" {
+		t.Error("Expected no ID without a namespace")
+	}
+	
+	// Deployments sharing a calendar get their own IDs
+	single := &config.Config{EventIDNamespace: "pike13sync"}
+	staging := &config.Config{EventIDNamespace: "pike13sync", InstanceID: "staging"}
+	if calendar.EventIDFor(single, "12345") != id {
+		t.Error("Expected the plain namespace without an instance ID")
+	}
+	if calendar.EventIDFor(staging, "12345") == id {
+		t.Error("Expected the instance ID to change the event ID")
+	}
+}
+
+// TestCreateEventExisting tests that creating an event whose ID is taken updates it instead
+func TestCreateEventExisting(t *testing.T) {
+	fake := &fakeCalendar{}
+	service := newTestService(t, fake, &config.Config{CalendarID: "test_calendar"})
+	newEvent := func(summary string) *calendar.Event {
+		event := testEvent(summary)
+		event.Id = calendar.EventID("pike13sync", "42")
+		return event
+	}
+	
+	if result, err := service.CreateEvent(newEvent("First Run")); err != nil || result != calendar.ResultCreated {
+		t.Fatalf("Expected first create to succeed, got %s, %v", result, err)
+	}
+	
+	// A rerun after a crash finds the event already there
+	if result, err := service.CreateEvent(newEvent("Second Run")); err != nil || result != calendar.ResultCreated {
+		t.Fatalf("Expected repeated create to succeed, got %s, %v", result, err)
+	}
+	if len(fake.events) != 1 || fake.events[0].Summary != "Second Run" {
+		t.Fatalf("Expected one event updated in place, got %d events", len(fake.events))
+	}
+	
+	// A deleted event keeps its ID and must be brought back
+	if _, err := service.DeleteEvent(newEvent("Second Run")); err != nil {
+		t.Fatalf("DeleteEvent returned error: %v", err)
+	}
+	if result, err := service.CreateEvent(newEvent("Third Run")); err != nil || result != calendar.ResultCreated {
+		t.Fatalf("Expected create of a deleted event to succeed, got %s, %v", result, err)
+	}
+	if len(fake.events) != 1 || fake.events[0].Status != "confirmed" || fake.events[0].Summary != "Third Run" {
+		t.Errorf("Expected the deleted event to be restored, got %+v", fake.events[0])
+	}
+}
+
+// TestExecuteBatch tests that batch items succeed or fail on their own
+func TestExecuteBatch(t *testing.T) {
+	fake := &fakeCalendar{
+		events: []*calendar.Event{syncedEvent("existing1", "1"), syncedEvent("existing2", "2")},
+		// Consumed by the first two batch items
+		failures: []fakeFailure{{400, "badRequest"}, {503, "backendError"}},
+	}
+	cfg := &config.Config{CalendarID: "test_calendar", CalendarRetry: fastRetry, CalendarRetryBudget: 10}
+	service := newTestService(t, fake, cfg)
+	
+	transient := testEvent("Transient Class")
+	restored := testEvent("Restored Class")
+	restored.Id = "existing1"
+	ops := []calendar.BatchOp{
+		{Kind: calendar.BatchInsert, Event: testEvent("Rejected Class")},
+		{Kind: calendar.BatchInsert, Event: transient},
+		{Kind: calendar.BatchUpdate, EventID: "existing1", Event: testEvent("Updated Class")},
+		{Kind: calendar.BatchDelete, Event: syncedEvent("existing2", "2")},
+		{Kind: calendar.BatchDelete, Event: syncedEvent("missing", "3")},
+		{Kind: calendar.BatchInsert, Event: restored},
+	}
+	
+	results := service.ExecuteBatch(ops)
+	if len(results) != len(ops) {
+		t.Fatalf("Expected %d results, got %d", len(ops), len(results))
+	}
+	expected := []calendar.Result{
+		calendar.ResultFailed,
+		calendar.ResultCreated,
+		calendar.ResultUpdated,
+		calendar.ResultDeleted,
+		calendar.ResultDeleted,
+		calendar.ResultCreated,
+	}
+	for i, result := range results {
+		if result.Result != expected[i] {
+			t.Errorf("Item %d: expected %s, got %s (%v)", i, expected[i], result.Result, result.Err)
+		}
+		if (result.Err != nil) != (i == 0) {
+			t.Errorf("Item %d: unexpected error state %v", i, result.Err)
+		}
+	}
+	if transient.Id == "" {
+		t.Error("Expected the created event ID to be set on the retried event")
+	}
+	if fake.events[0].Summary != "Restored Class" {
+		t.Errorf("Expected the conflicting insert to update the existing event, got %q", fake.events[0].Summary)
+	}
+	
+	// One batch, then the transient insert and the conflict on their own
+	if mutations := fake.mutationCount(); mutations != 3 {
+		t.Errorf("Expected 3 requests, got %d", mutations)
+	}
+}
+
+// TestExecuteBatchSplits tests that large batches are split at MaxBatchSize
+func TestExecuteBatchSplits(t *testing.T) {
+	fake := &fakeCalendar{}
+	service := newTestService(t, fake, &config.Config{CalendarID: "test_calendar"})
+	
+	var ops []calendar.BatchOp
+	for i := 0; i < calendar.MaxBatchSize+10; i++ {
+		ops = append(ops, calendar.BatchOp{Kind: calendar.BatchInsert, Event: testEvent(fmt.Sprintf("Class %d", i))})
+	}
+	
+	for i, result := range service.ExecuteBatch(ops) {
+		if result.Err != nil || result.Result != calendar.ResultCreated {
+			t.Errorf("Item %d: expected %s, got %s (%v)", i, calendar.ResultCreated, result.Result, result.Err)
+		}
+	}
+	if len(fake.events) != len(ops) {
+		t.Errorf("Expected %d events, got %d", len(ops), len(fake.events))
+	}
+	if mutations := fake.mutationCount(); mutations != 2 {
+		t.Errorf("Expected 2 batch requests, got %d", mutations)
+	}
+}
+
+// TestIncrementalSync tests that later reads only fetch changes, that edits
+// by others are noticed and that an expired sync token triggers a full read
+func TestIncrementalSync(t *testing.T) {
+	timedEvent := func(id, pike13ID, start string) *calendar.Event {
+		event := syncedEvent(id, pike13ID)
+		event.Start = &calendar.EventDateTime{DateTime: start}
+		event.End = &calendar.EventDateTime{DateTime: start}
+		event.ExtendedProperties.Private[calendar.PropertyHash] = calendar.ContentHash(event)
+		return event
+	}
+	fake := &fakeCalendar{events: []*calendar.Event{
+		timedEvent("evt1", "1", "2025-05-12T17:00:00Z"),
+		timedEvent("evt2", "2", "2025-05-13T17:00:00Z"),
+		timedEvent("evt3", "3", "2025-06-01T17:00:00Z"), // Outside the window
+		{Id: "other", Summary: "Not synced", Start: &calendar.EventDateTime{DateTime: "2025-05-12T09:00:00Z"}},
+	}}
+	cfg := &config.Config{
+		CalendarID:        "test_calendar",
+		IncrementalSync:   true,
+		CalendarCachePath: filepath.Join(t.TempDir(), "calendar_cache.json"),
+	}
+	service := newTestService(t, fake, cfg)
+	read := func() []*calendar.Event {
+		t.Helper()
+		events, err := service.GetExistingEvents("2025-05-12T00:00:00Z", "2025-05-19T00:00:00Z")
+		if err != nil {
+			t.Fatalf("GetExistingEvents returned error: %v", err)
+		}
+		return events
+	}
+	lastQuery := func() url.Values {
+		return fake.requests[len(fake.requests)-1].URL.Query()
+	}
+	
+	// The first read lists everything and keeps a sync token
+	if events := read(); len(events) != 2 || events[0].Id != "evt1" || events[1].Id != "evt2" {
+		t.Fatalf("Expected evt1 and evt2 from the full read, got %d events", len(events))
+	}
+	if lastQuery().Get("syncToken") != "" {
+		t.Error("Expected the first read to be a full listing")
+	}
+	
+	// Someone edits one event by hand and this tool deletes another
+	fake.events[0].Summary = "Renamed by hand"
+	fake.touch("evt1")
+	if _, err := service.DeleteEvent(fake.events[1]); err != nil {
+		t.Fatalf("DeleteEvent returned error: %v", err)
+	}
+	
+	events := read()
+	if lastQuery().Get("syncToken") == "" {
+		t.Error("Expected the second read to use the sync token")
+	}
+	if len(events) != 1 || events[0].Summary != "Renamed by hand" {
+		t.Fatalf("Expected only the edited event, got %d events", len(events))
+	}
+	// The plan finds the edit on the returned event
+	if !calendar.IsEdited(events[0]) {
+		t.Error("Expected evt1 to be detected as edited")
+	}
+	
+	// An expired token falls back to a full read
+	fake.expireTokens = true
+	requests := len(fake.requests)
+	if events := read(); len(events) != 1 || events[0].Id != "evt1" {
+		t.Fatalf("Expected evt1 after the full read, got %d events", len(events))
+	}
+	if len(fake.requests) != requests+2 || lastQuery().Get("syncToken") != "" {
+		t.Errorf("Expected a rejected incremental read followed by a full listing, got %d requests", len(fake.requests)-requests)
+	}
+}
+
+// TestUpdateEventPreservesFields tests that updates only patch managed fields
+func TestUpdateEventPreservesFields(t *testing.T) {
+	existing := syncedEvent("evt1", "42")
+	existing.Location = "Studio B"
+	existing.Attendees = []*gcalendar.EventAttendee{{Email: "coach@example.com"}}
+	existing.Reminders = &gcalendar.EventReminders{Overrides: []*gcalendar.EventReminder{{Method: "popup", Minutes: 15}}}
+	existing.ExtendedProperties.Private["other_tool"] = "keep me"
+	existing.ExtendedProperties.Private[calendar.PropertyAccepted] = "v3:accepted"
+	fake := &fakeCalendar{events: []*calendar.Event{existing}}
+	service := newTestService(t, fake, &config.Config{CalendarID: "test_calendar", TimeZone: "America/Los_Angeles"})
+	
+	event := service.FormatEventData(pike13.Pike13Event{
+		ID:      42,
+		Name:    "Renamed Class",
+		StartAt: "2025-05-15T14:00:00Z",
+		EndAt:   "2025-05-15T15:00:00Z",
+		State:   "active",
+	})
+	batched := service.FormatEventData(pike13.Pike13Event{ID: 42, Name: "Batched Class", StartAt: "2025-05-15T16:00:00Z", EndAt: "2025-05-15T17:00:00Z", State: "active"})
+	
+	check := func(label, summary string) {
+		t.Helper()
+		updated := fake.events[0]
+		if updated.Summary != summary || calendar.StoredHash(updated) != calendar.ContentHash(updated) {
+			t.Errorf("%s: expected managed fields to be written, got summary %q", label, updated.Summary)
+		}
+		if updated.Location != "Studio B" || len(updated.Attendees) != 1 || updated.Reminders == nil {
+			t.Errorf("%s: expected location, attendees and reminders to be kept, got %+v", label, updated)
+		}
+		if updated.ExtendedProperties.Private["other_tool"] != "keep me" {
+			t.Errorf("%s: expected other private properties to be kept", label)
+		}
+	}
+	
+	if _, err := service.UpdateEvent("evt1", event); err != nil {
+		t.Fatalf("UpdateEvent returned error: %v", err)
+	}
+	check("UpdateEvent", "Renamed Class")
+	if calendar.IsEdited(fake.events[0]) {
+		t.Error("Expected the unmanaged location not to count as an edit")
+	}
+	if calendar.AcceptedHash(fake.events[0]) != "" {
+		t.Error("Expected writing Pike13 data to clear an accepted edit")
+	}
+	
+	results := service.ExecuteBatch([]calendar.BatchOp{{Kind: calendar.BatchUpdate, EventID: "evt1", Event: batched}})
+	if results[0].Err != nil {
+		t.Fatalf("Batched update returned error: %v", results[0].Err)
+	}
+	check("Batched update", "Batched Class")
+	
+	// Cancelling changes the status and nothing else
+	cancelled := *batched
+	cancelled.Status = "cancelled"
+	cancelled.Description = ""
+	cancelled.ColorId = ""
+	description := fake.events[0].Description
+	if _, err := service.UpdateEvent("evt1", &cancelled); err != nil {
+		t.Fatalf("UpdateEvent returned error: %v", err)
+	}
+	if updated := fake.events[0]; updated.Status != "cancelled" || updated.Description != description || description == "" {
+		t.Errorf("Expected only the status to change, got status %q and description %q", updated.Status, updated.Description)
+	}
+	check("Cancel", "Batched Class")
+}
+
+// TestFormatEventDataTemplates tests the default layout and custom templates
+func TestFormatEventDataTemplates(t *testing.T) {
+	class := pike13.Pike13Event{
+		ID:                42,
+		Name:              "Morning Yoga",
+		Description:       "Bring a mat",
+		StartAt:           "2025-05-15T14:00:00Z",
+		EndAt:             "2025-05-15T15:00:00Z",
+		State:             "active",
+		CapacityRemaining: 3,
+		StaffMembers:      []pike13.StaffMember{{ID: 1, Name: "Ann"}, {ID: 2, Name: "Bo"}},
+	}
+	
+	service := newTestService(t, &fakeCalendar{}, &config.Config{CalendarID: "test_calendar"})
+	event := service.FormatEventData(class)
+	want := "Bring a mat\n\nStatus: Active\nCapacity: Spaces available: 3\nWaitlist: Waitlist is OPEN\nInstructor(s): Ann, Bo\n"
+	if event.Summary != "Morning Yoga" || event.Description != want {
+		t.Errorf("Unexpected default rendering: %q / %q", event.Summary, event.Description)
+	}
+	if event.Location != "" || calendar.ManagesLocation(event) {
+		t.Error("Expected locations to be left alone without a location template")
+	}
+	
+	cancelled := pike13.Pike13Event{ID: 43, Name: "Full Class", State: "canceled", Full: true, Waitlist: pike13.Waitlist{Full: true}}
+	want = "Status: Cancelled\nCapacity: Class is FULL\nWaitlist: Waitlist is FULL\n"
+	if got := service.FormatEventData(cancelled).Description; got != want {
+		t.Errorf("Unexpected default rendering of a cancelled class: %q", got)
+	}
+	
+	service = newTestService(t, &fakeCalendar{}, &config.Config{
+		CalendarID:          "test_calendar",
+		SummaryTemplate:     `{{.Name}}{{if isFull .}} (full){{end}}`,
+		DescriptionTemplate: `{{spotsLeft .}} spots with {{staffList .}}{{if isCancelled .}}, cancelled{{end}}`,
+		LocationTemplate:    ` Studio {{.EventID}} `,
+	})
+	class.Full = true
+	class.EventID = 7
+	event = service.FormatEventData(class)
+	if event.Summary != "Morning Yoga (full)" || event.Description != "3 spots with Ann, Bo" || event.Location != "Studio 7" {
+		t.Errorf("Unexpected custom rendering: %q / %q / %q", event.Summary, event.Description, event.Location)
+	}
+	
+	// A managed location is part of the content hash
+	if !calendar.ManagesLocation(event) {
+		t.Fatal("Expected the location to be managed")
+	}
+	moved := copyEvent(event)
+	moved.Location = "Elsewhere"
+	if !calendar.IsEdited(moved) {
+		t.Error("Expected a changed managed location to count as an edit")
+	}
+	if patch := calendar.ManagedPatch(event); patch.Location != "Studio 7" {
+		t.Errorf("Expected the location in the patch, got %q", patch.Location)
+	}
+}
+
+// TestNewTemplatesInvalid tests that broken templates are rejected at startup
+func TestNewTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"Syntax error", config.Config{SummaryTemplate: "{{.Name"}},
+		{"Unknown field", config.Config{DescriptionTemplate: "{{.Room}}"}},
+		{"Unknown function", config.Config{LocationTemplate: "{{room .}}"}},
+	}
+	
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := calendar.NewTemplates(&tc.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestColorRules tests that the first matching color rule wins over the defaults
+func TestColorRules(t *testing.T) {
+	full := true
+	service := newTestService(t, &fakeCalendar{}, &config.Config{
+		CalendarID: "test_calendar",
+		ColorRules: []config.ColorRule{
+			{Color: "sage", EventCondition: config.EventCondition{NamePattern: "(?i)yoga"}},
+			{Color: "6", EventCondition: config.EventCondition{Full: &full}},
+			{Color: "Blueberry", EventCondition: config.EventCondition{Staff: []string{"Kim"}, States: []string{"active"}}},
+		},
+	})
+	
+	tests := []struct {
+		name  string
+		event pike13.Pike13Event
+		color string
+	}{
+		{"Name", pike13.Pike13Event{Name: "Morning Yoga", State: "active", Full: true}, "2"},
+		{"Full", pike13.Pike13Event{Name: "HIIT", State: "active", Full: true}, "6"},
+		{"Staff", pike13.Pike13Event{Name: "Kids Gym", State: "active", StaffMembers: []pike13.StaffMember{{Name: "Kim"}}}, "9"},
+		{"Default active", pike13.Pike13Event{Name: "HIIT", State: "active"}, calendar.DefaultActiveColor},
+		{"Default cancelled", pike13.Pike13Event{Name: "Kids Gym", State: "canceled", StaffMembers: []pike13.StaffMember{{Name: "Kim"}}}, calendar.DefaultCancelledColor},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := service.FormatEventData(tc.event).ColorId; got != tc.color {
+				t.Errorf("Expected color %s, got %s", tc.color, got)
+			}
+		})
+	}
+	
+	// Colors outside the palette are rejected
+	for _, color := range []string{"0", "12", "pink", ""} {
+		cfg := &config.Config{ColorRules: []config.ColorRule{{Color: color, EventCondition: config.EventCondition{States: []string{"active"}}}}}
+		if _, err := calendar.NewColorRules(cfg); err == nil {
+			t.Errorf("Expected an error for color %q", color)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package calendar
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/filter"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+)
+
+// Palette is Google Calendar's fixed event color palette, by color ID, as
+// returned by the Colors.Get API
+var Palette = map[string]string{
+	"1":  "Lavender",
+	"2":  "Sage",
+	"3":  "Grape",
+	"4":  "Flamingo",
+	"5":  "Banana",
+	"6":  "Tangerine",
+	"7":  "Peacock",
+	"8":  "Graphite",
+	"9":  "Blueberry",
+	"10": "Basil",
+	"11": "Tomato",
+}
+
+// Default event colors, used when no color rule matches
+const (
+	DefaultActiveColor    = "11" // Tomato
+	DefaultCancelledColor = "8"  // Graphite
+)
+
+// ColorRules picks the color of calendar events. The first rule whose
+// conditions match wins; other events are red, or gray when not active.
+type ColorRules struct {
+	rules []colorRule
+}
+
+// colorRule is a compiled config.ColorRule
+type colorRule struct {
+	colorID string
+	*filter.Condition
+}
+
+// NewColorRules validates the configured color rules. Colors may be given by
+// palette ID or name.
+func NewColorRules(cfg *config.Config) (*ColorRules, error) {
+	loc, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", cfg.TimeZone, err)
+	}
+	
+	c := &ColorRules{}
+	for i, r := range cfg.ColorRules {
+		colorID, err := PaletteID(r.Color)
+		if err != nil {
+			return nil, fmt.Errorf("color rule %d: %v", i+1, err)
+		}
+		cond, err := filter.NewCondition(r.EventCondition, loc)
+		if err != nil {
+			return nil, fmt.Errorf("color rule %d: %v", i+1, err)
+		}
+		c.rules = append(c.rules, colorRule{colorID: colorID, Condition: cond})
+	}
+	return c, nil
+}
+
+// ColorFor returns the color ID for a Pike13 event
+func (c *ColorRules) ColorFor(event pike13.Pike13Event) string {
+	for _, rule := range c.rules {
+		if rule.Matches(event) {
+			return rule.colorID
+		}
+	}
+	if event.State != "active" {
+		return DefaultCancelledColor
+	}
+	return DefaultActiveColor
+}
+
+// PaletteID resolves a color ID or name (case-insensitive) to a color ID of
+// the event palette
+func PaletteID(color string) (string, error) {
+	color = strings.TrimSpace(color)
+	if _, ok := Palette[color]; ok {
+		return color, nil
+	}
+	for id, name := range Palette {
+		if strings.EqualFold(name, color) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event color %q (expected 1 to 11 or a palette name such as sage or tomato)", color)
+}
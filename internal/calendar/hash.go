@@ -0,0 +1,104 @@
+package calendar
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// hashVersion is bumped whenever the hashed content changes shape, so every
+// event is rewritten once with the new fields
+const hashVersion = "v3"
+
+// hashedField is one managed field as it is hashed
+type hashedField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ContentHash returns a canonical hash of the fields pike13sync manages on an
+// event (see managedFields). Times are compared as instants, so Google
+// rewriting "2025-05-12T17:00:00Z" as "2025-05-12T10:00:00-07:00" is not a
+// change. Extended properties, including the stored hash itself, are not hashed.
+func ContentHash(event *calendar.Event) string {
+	var content []hashedField
+	for _, field := range managedFields {
+		if field.managed == nil || field.managed(event) {
+			content = append(content, hashedField{Name: field.name, Value: field.value(event)})
+		}
+	}
+	
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(append([]byte(hashVersion+":"), data...))
+	return hashVersion + ":" + hex.EncodeToString(sum[:])
+}
+
+// StoredHash returns the content hash recorded on an event when it was last
+// synced, or "" for events written before hashes were stored
+func StoredHash(event *calendar.Event) string {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return ""
+	}
+	return event.ExtendedProperties.Private[PropertyHash]
+}
+
+// AcceptedHash returns the hash of the Pike13 data an accepted calendar edit
+// replaced, or "" when the event shows Pike13 data
+func AcceptedHash(event *calendar.Event) string {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return ""
+	}
+	return event.ExtendedProperties.Private[PropertyAccepted]
+}
+
+// IsEdited reports whether an event was changed by someone else since
+// pike13sync wrote it: its managed fields no longer match the stored hash.
+// Events without a hash, or with one from an older hash version, cannot tell.
+func IsEdited(event *calendar.Event) bool {
+	stored := StoredHash(event)
+	if !strings.HasPrefix(stored, hashVersion+":") {
+		return false
+	}
+	return stored != ContentHash(event)
+}
+
+// NormalizeDateTime converts an RFC3339 time to UTC so equal instants compare
+// equal. Values that do not parse are returned unchanged.
+func NormalizeDateTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// canonicalTime normalizes an event start or end for comparison: the instant
+// in UTC, or the date of all-day events, followed by the time zone if set
+func canonicalTime(dt *calendar.EventDateTime) string {
+	if dt == nil {
+		return ""
+	}
+	value := NormalizeDateTime(dt.DateTime)
+	if value == "" {
+		value = dt.Date
+	}
+	if dt.TimeZone != "" {
+		value += " (" + dt.TimeZone + ")"
+	}
+	return value
+}
+
+// canonicalSource describes an event source link for comparison
+func canonicalSource(event *calendar.Event) string {
+	if event.Source == nil {
+		return ""
+	}
+	if event.Source.Title == "" {
+		return event.Source.Url
+	}
+	return event.Source.Title + " <" + event.Source.Url + ">"
+}
@@ -1,7 +1,39 @@
 package calendar
 
 import (
+	"encoding/base32"
+	"strings"
+
 	"google.golang.org/api/calendar/v3"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+)
+
+// Private extended properties pike13sync stores on the events it owns
+const (
+	// PropertyPike13ID holds the Pike13 event occurrence ID
+	PropertyPike13ID = "pike13_id"
+	
+	// PropertySynced marks an event as created by pike13sync
+	PropertySynced = "pike13_sync"
+	
+	// PropertyHash holds the ContentHash of the event as last written by pike13sync
+	PropertyHash = "pike13_hash"
+	
+	// PropertyInstance holds the instance_id of the deployment that owns the event
+	PropertyInstance = "pike13_instance"
+	
+	// PropertyRemoved is "true" on events kept in the calendar, marked as
+	// removed, after their Pike13 occurrence disappeared
+	PropertyRemoved = "pike13_removed"
+	
+	// PropertyLocation is "true" on events whose location is rendered from
+	// location_template and managed like the other fields
+	PropertyLocation = "pike13_location"
+	
+	// PropertyAccepted holds the ContentHash of the Pike13 data an edit made
+	// in Google Calendar was accepted over, under conflict_policy calendar
+	PropertyAccepted = "pike13_accepted"
 )
 
 // Event is a wrapper around Google Calendar Event for any specific functionality
@@ -12,3 +44,186 @@ type EventDateTime = calendar.EventDateTime
 
 // ExtendedProperties is a wrapper around Google Calendar ExtendedProperties
 type ExtendedProperties = calendar.EventExtendedProperties
+
+// EventSource is a wrapper around Google Calendar EventSource
+type EventSource = calendar.EventSource
+
+// Result describes what a calendar mutation did to an event
+type Result string
+
+const (
+	ResultCreated   Result = "created"
+	ResultUpdated   Result = "updated"
+	ResultUnchanged Result = "unchanged"
+	ResultDeleted   Result = "deleted"
+	ResultFailed    Result = "failed"
+)
+
+// eventIDEncoding produces IDs in the alphabet Google accepts for custom event IDs (a-v, 0-9)
+var eventIDEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// managedField is an event field pike13sync writes
+type managedField struct {
+	name    string                    // Field name in the Calendar API
+	value   func(*Event) string       // Canonical value, compared for hashes and plan diffs
+	copy    func(patch, event *Event) // Copies the field into a patch
+	managed func(*Event) bool         // Whether the field is managed on an event; nil for always
+}
+
+// managedFields are the event fields pike13sync writes, besides its own
+// private extended properties (see the Property constants). ManagedPatch
+// sends only these, ContentHash hashes them and ManagedChanges compares them;
+// everything else on an event is left as people or other tools set it.
+// Summary, description, color and location are always sent so they can be
+// cleared.
+var managedFields = []managedField{
+	{
+		name:  "summary",
+		value: func(e *Event) string { return e.Summary },
+		copy: func(patch, e *Event) {
+			patch.Summary = e.Summary
+			patch.ForceSendFields = append(patch.ForceSendFields, "Summary")
+		},
+	},
+	{
+		name:  "description",
+		value: func(e *Event) string { return e.Description },
+		copy: func(patch, e *Event) {
+			patch.Description = e.Description
+			patch.ForceSendFields = append(patch.ForceSendFields, "Description")
+		},
+	},
+	{
+		name:  "start",
+		value: func(e *Event) string { return canonicalTime(e.Start) },
+		copy:  func(patch, e *Event) { patch.Start = e.Start },
+	},
+	{
+		name:  "end",
+		value: func(e *Event) string { return canonicalTime(e.End) },
+		copy:  func(patch, e *Event) { patch.End = e.End },
+	},
+	{
+		name:  "colorId",
+		value: func(e *Event) string { return e.ColorId },
+		copy: func(patch, e *Event) {
+			patch.ColorId = e.ColorId
+			patch.ForceSendFields = append(patch.ForceSendFields, "ColorId")
+		},
+	},
+	{
+		name:  "source",
+		value: canonicalSource,
+		copy:  func(patch, e *Event) { patch.Source = e.Source },
+	},
+	{
+		name:  "location",
+		value: func(e *Event) string { return e.Location },
+		copy: func(patch, e *Event) {
+			patch.Location = e.Location
+			patch.ForceSendFields = append(patch.ForceSendFields, "Location")
+		},
+		managed: ManagesLocation,
+	},
+}
+
+// ManagesLocation reports whether pike13sync writes the location of an event
+func ManagesLocation(event *Event) bool {
+	return event.ExtendedProperties != nil && event.ExtendedProperties.Private[PropertyLocation] == "true"
+}
+
+// FieldChange is a managed field whose value differs between two events
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// ManagedChanges lists the managed fields of desired that differ on existing,
+// comparing canonical values
+func ManagedChanges(existing, desired *Event) []FieldChange {
+	var changes []FieldChange
+	for _, field := range managedFields {
+		if field.managed != nil && !field.managed(desired) {
+			continue
+		}
+		if old, new := field.value(existing), field.value(desired); old != new {
+			changes = append(changes, FieldChange{Field: field.name, Old: old, New: new})
+		}
+	}
+	return changes
+}
+
+// ManagedPatch returns a patch carrying only the managed fields of event.
+// The status is sent when set, to restore deleted events. Cancelling an event
+// only changes its status, so nothing else is sent for cancelled events.
+// Private properties are merged by Google, so properties added by other tools
+// survive.
+func ManagedPatch(event *Event) *Event {
+	patch := &Event{Status: event.Status}
+	if event.Status == "cancelled" {
+		return patch
+	}
+	for _, field := range managedFields {
+		if field.managed == nil || field.managed(event) {
+			field.copy(patch, event)
+		}
+	}
+	
+	private := map[string]string{}
+	if event.ExtendedProperties != nil {
+		for key, value := range event.ExtendedProperties.Private {
+			private[key] = value
+		}
+	}
+	if len(private) > 0 {
+		// Merging would keep an old "true" once location_template is removed
+		if private[PropertyLocation] == "" {
+			private[PropertyLocation] = "false"
+		}
+		// Likewise an accepted edit once Pike13 data overwrites it
+		if _, ok := private[PropertyAccepted]; !ok {
+			private[PropertyAccepted] = ""
+		}
+		patch.ExtendedProperties = &ExtendedProperties{Private: private}
+	}
+	return patch
+}
+
+// EventID returns the deterministic Google event ID for a Pike13 occurrence.
+// The namespace keeps IDs from colliding with other tools writing to the
+// same calendar. An empty namespace returns "" and lets Google pick the ID.
+func EventID(namespace, pike13ID string) string {
+	if namespace == "" {
+		return ""
+	}
+	return strings.ToLower(eventIDEncoding.EncodeToString([]byte(namespace + ":" + pike13ID)))
+}
+
+// EventIDFor returns the deterministic event ID a deployment uses for a Pike13
+// occurrence. The instance ID is part of the namespace so deployments sharing
+// a calendar never claim each other's events.
+func EventIDFor(cfg *config.Config, pike13ID string) string {
+	namespace := cfg.EventIDNamespace
+	if namespace != "" && cfg.InstanceID != "" {
+		namespace += "/" + cfg.InstanceID
+	}
+	return EventID(namespace, pike13ID)
+}
+
+// InstanceOf returns the instance ID an event is tagged with, or "" for
+// events written before instances were tagged
+func InstanceOf(event *calendar.Event) string {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return ""
+	}
+	return event.ExtendedProperties.Private[PropertyInstance]
+}
+
+// IsRemoved reports whether an event was marked as removed from Pike13
+func IsRemoved(event *calendar.Event) bool {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return false
+	}
+	return event.ExtendedProperties.Private[PropertyRemoved] == "true"
+}
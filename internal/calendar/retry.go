@@ -0,0 +1,158 @@
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/util"
+)
+
+// Reasons Google reports for quota errors that succeed when retried later
+var retryableReasons = map[string]bool{
+	"rateLimitExceeded":     true,
+	"userRateLimitExceeded": true,
+	"backendError":          true,
+}
+
+// IsRetryable reports whether a Google Calendar API error is transient.
+// Rate limits and server errors are retryable; other API errors are permanent.
+// Errors that never reached the API (network failures) are retried as well.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	
+	switch apiErr.Code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	case http.StatusForbidden:
+		// 403 is used both for quota errors and for real permission problems
+		for _, item := range apiErr.Errors {
+			if retryableReasons[item.Reason] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isConflict reports whether an API error says an event with the same ID
+// already exists, including one that was deleted and is kept as cancelled
+func isConflict(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// isGone reports whether an API error says the event no longer exists
+func isGone(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Code == http.StatusGone || apiErr.Code == http.StatusNotFound
+}
+
+// retrier retries calendar API calls, sharing one retry budget across a run
+type retrier struct {
+	config config.RetryConfig
+	
+	mu     sync.Mutex
+	budget int
+}
+
+// newRetrier creates a retrier allowing at most budget retries in total;
+// a negative budget means unlimited
+func newRetrier(retryConfig config.RetryConfig, budget int) *retrier {
+	return &retrier{
+		config: retryConfig,
+		budget: budget,
+	}
+}
+
+// takeRetry consumes one retry from the budget, reporting false when exhausted
+func (r *retrier) takeRetry() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	
+	if r.budget < 0 {
+		return true
+	}
+	if r.budget == 0 {
+		return false
+	}
+	r.budget--
+	return true
+}
+
+// do runs call until it succeeds, fails permanently, or the attempts,
+// deadline or run budget are used up. The returned error names the final
+// attempt count and wraps the last API error.
+func (r *retrier) do(description string, call func() error) error {
+	maxAttempts := r.config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("%s succeeded after %d attempts", description, attempt)
+			}
+			return nil
+		}
+		
+		if !IsRetryable(err) {
+			return fmt.Errorf("%s failed permanently: %w", description, err)
+		}
+		if attempt >= maxAttempts {
+			return fmt.Errorf("%s failed after %d attempt(s): %w", description, attempt, err)
+		}
+		
+		delay := util.BackoffDelay(r.config.BaseDelay.Duration, r.config.MaxDelay.Duration, attempt)
+		if retryAfter, ok := retryAfterDelay(err); ok && retryAfter > delay {
+			delay = retryAfter
+		}
+		if r.config.Deadline.Duration > 0 && time.Since(start)+delay > r.config.Deadline.Duration {
+			return fmt.Errorf("%s failed after %d attempt(s), retry deadline reached: %w", description, attempt, err)
+		}
+		if !r.takeRetry() {
+			return fmt.Errorf("%s failed after %d attempt(s), retry budget exhausted: %w", description, attempt, err)
+		}
+		
+		log.Printf("%s failed (%v), attempt %d/%d; retrying in %s",
+			description, err, attempt, maxAttempts, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// retryAfterDelay extracts a Retry-After delay in seconds from an API error
+func retryAfterDelay(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Header == nil {
+		return 0, false
+	}
+	seconds, parseErr := strconv.Atoi(apiErr.Header.Get("Retry-After"))
+	if parseErr != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
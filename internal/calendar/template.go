@@ -0,0 +1,135 @@
+package calendar
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+)
+
+// Default templates, producing the built-in event layout
+const (
+	DefaultSummaryTemplate = `{{.Name}}`
+	
+	DefaultDescriptionTemplate = "{{with .Description}}{{.}}\n\n{{end}}" +
+		"Status: {{if isCancelled .}}Cancelled{{else}}Active{{end}}\n" +
+		"Capacity: {{if .Full}}Class is FULL{{else}}Spaces available: {{spotsLeft .}}{{end}}\n" +
+		"Waitlist: {{if .Waitlist.Full}}Waitlist is FULL{{else}}Waitlist is OPEN{{end}}\n" +
+		"{{with staffList .}}Instructor(s): {{.}}\n{{end}}"
+)
+
+// templateFuncs are the helpers available to event templates, next to the
+// fields of pike13.Pike13Event
+var templateFuncs = template.FuncMap{
+	// staffList joins the staff member names with commas
+	"staffList": func(event pike13.Pike13Event) string {
+		names := make([]string, 0, len(event.StaffMembers))
+		for _, staff := range event.StaffMembers {
+			names = append(names, staff.Name)
+		}
+		return strings.Join(names, ", ")
+	},
+	// spotsLeft is the number of places still free
+	"spotsLeft": func(event pike13.Pike13Event) int {
+		return event.CapacityRemaining
+	},
+	// isFull reports whether the class has no places left
+	"isFull": func(event pike13.Pike13Event) bool {
+		return event.Full
+	},
+	// isCancelled reports whether the class is not running (any state but active)
+	"isCancelled": func(event pike13.Pike13Event) bool {
+		return event.State != "active"
+	},
+}
+
+// sampleEvent is rendered at startup so templates referring to missing
+// fields fail before anything is synced
+var sampleEvent = pike13.Pike13Event{
+	ID:                1,
+	Name:              "Sample Class",
+	Description:       "Sample description",
+	StartAt:           "2025-01-06T17:00:00Z",
+	EndAt:             "2025-01-06T18:00:00Z",
+	State:             "active",
+	CapacityRemaining: 5,
+	StaffMembers:      []pike13.StaffMember{{ID: 1, Name: "Sample Instructor"}},
+}
+
+// Templates renders the summary, description and location of calendar events
+type Templates struct {
+	summary     *template.Template
+	description *template.Template
+	location    *template.Template // nil when locations are not managed
+}
+
+// NewTemplates parses the configured event templates, falling back to the
+// defaults for empty ones, and checks they render
+func NewTemplates(cfg *config.Config) (*Templates, error) {
+	t := &Templates{}
+	var err error
+	if t.summary, err = parseTemplate("summary_template", cfg.SummaryTemplate, DefaultSummaryTemplate); err != nil {
+		return nil, err
+	}
+	if t.description, err = parseTemplate("description_template", cfg.DescriptionTemplate, DefaultDescriptionTemplate); err != nil {
+		return nil, err
+	}
+	if cfg.LocationTemplate != "" {
+		if t.location, err = parseTemplate("location_template", cfg.LocationTemplate, ""); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// parseTemplate parses one template and renders it for the sample event
+func parseTemplate(name, text, fallback string) (*template.Template, error) {
+	if text == "" {
+		text = fallback
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sampleEvent); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// render executes a template for an event. A template that fails for this
+// particular event is logged and leaves the field empty.
+func render(tmpl *template.Template, event pike13.Pike13Event) string {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, event); err != nil {
+		log.Printf("Warning: error rendering %s for Pike13 event %d: %v", tmpl.Name(), event.ID, err)
+		return ""
+	}
+	return out.String()
+}
+
+// Summary renders the event title. An empty title falls back to the class name.
+func (t *Templates) Summary(event pike13.Pike13Event) string {
+	if summary := render(t.summary, event); strings.TrimSpace(summary) != "" {
+		return summary
+	}
+	return event.Name
+}
+
+// Description renders the event description
+func (t *Templates) Description(event pike13.Pike13Event) string {
+	return render(t.description, event)
+}
+
+// Location renders the event location. The second result is false when no
+// location template is configured and locations are left alone.
+func (t *Templates) Location(event pike13.Pike13Event) (string, bool) {
+	if t.location == nil {
+		return "", false
+	}
+	return strings.TrimSpace(render(t.location, event)), true
+}
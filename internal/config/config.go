@@ -8,8 +8,75 @@ import (
 	"path/filepath"
 	"strings"
 	"runtime"
+	"time"
 )
 
+// RetryConfig controls how transient API failures are retried
+type RetryConfig struct {
+	MaxAttempts int      `json:"max_attempts"` // Total attempts including the first; 0 or 1 disables retries
+	BaseDelay   Duration `json:"base_delay"`   // Backoff before the second attempt, doubled after each retry
+	MaxDelay    Duration `json:"max_delay"`    // Upper bound for a single backoff
+	Deadline    Duration `json:"deadline"`     // Total time budget across all attempts; 0 means no limit
+}
+
+// Duration is a time.Duration read from JSON as a string such as "500ms" or "2m"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON accepts duration strings, or plain numbers as seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %v", v, err)
+		}
+		d.Duration = parsed
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	default:
+		return fmt.Errorf("invalid duration: %s", string(data))
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration in the same string form it is read in
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// EventCondition selects Pike13 events. Every condition that is set must
+// match; list conditions match when any entry does.
+type EventCondition struct {
+	NamePattern  string   `json:"name_pattern,omitempty"`  // Regular expression matched against the class name
+	Staff        []string `json:"staff,omitempty"`         // Staff member IDs or names (case-insensitive)
+	States       []string `json:"states,omitempty"`        // Pike13 occurrence states such as "active" or "canceled"
+	Weekdays     []string `json:"weekdays,omitempty"`      // Days the class starts on, such as "monday" or "sat"
+	After        string   `json:"after,omitempty"`         // Classes starting at or after this time of day ("06:00")
+	Before       string   `json:"before,omitempty"`        // Classes starting before this time of day ("21:30")
+	Full         *bool    `json:"full,omitempty"`          // Whether the class is full
+	WaitlistFull *bool    `json:"waitlist_full,omitempty"` // Whether the waitlist is full
+}
+
+// ColorRule gives the Pike13 events matching its conditions a calendar color
+type ColorRule struct {
+	Color string `json:"color"` // Google event color ID ("1" to "11") or name ("sage", "tomato", ...)
+	EventCondition
+}
+
+// FilterRule includes or excludes the Pike13 events matching its conditions
+type FilterRule struct {
+	Name   string `json:"name,omitempty"` // Shown in the run summary; defaults to the action and position
+	Action string `json:"action"`         // "include" or "exclude"
+	EventCondition
+}
+
 // Config holds application configuration
 type Config struct {
 	Pike13URL             string `json:"pike13_url"`
@@ -18,14 +85,76 @@ type Config struct {
 	CredentialsPath       string `json:"credentials_path"`
 	LogPath               string `json:"log_path"`
 	DryRun                bool   `json:"dry_run"`
+	CalendarMaxResults    int    `json:"calendar_max_results"` // Page size when listing calendar events
+	Pike13PageSize        int    `json:"pike13_page_size"`     // Page size when fetching Pike13 occurrences
+	Pike13Retry           RetryConfig `json:"pike13_retry"`    // Retries of transient Pike13 API failures
+	CalendarRetry         RetryConfig `json:"calendar_retry"`  // Retries of transient Google Calendar mutation failures
+	CalendarRetryBudget   int    `json:"calendar_retry_budget"` // Total calendar retries allowed per run; negative means unlimited
+	CalendarConcurrency   int    `json:"calendar_concurrency"` // Calendar changes made in parallel; 1 applies them one at a time
+	CalendarQPS           float64 `json:"calendar_qps"`        // Most calendar changes started per second; 0 means no limit
+	CalendarBatchSize     int    `json:"calendar_batch_size"`  // Calendar changes sent per batch request (at most 50); 1 disables batching
+	MaxDeletes            int    `json:"max_deletes"`          // Most deletes a run may make without --force; 0 means no limit
+	MaxDeletePercent      float64 `json:"max_delete_percent"`  // Most deletes as a percentage of existing synced events; 0 means no limit
+	AllowEmptyPike13      bool   `json:"allow_empty_pike13"`   // Trust an empty Pike13 response and delete everything in the window
+	StatePath             string `json:"state_path"`           // Local sync state file; empty disables the state store
+	IncrementalSync       bool   `json:"incremental_sync"`     // Read only calendar changes since the last run using a sync token
+	CalendarCachePath     string `json:"calendar_cache_path"`  // Local copy of synced calendar events used by incremental_sync
+	EventIDNamespace      string `json:"event_id_namespace"`   // Prefix of deterministic event IDs; empty lets Google assign IDs
+	DuplicatePolicy       string `json:"duplicate_policy"`     // What to do with extra copies of a synced event: "delete" or "report"
+	ConflictPolicy        string `json:"conflict_policy"`      // What to do with synced events edited in Google Calendar: "pike13", "calendar" or "skip"
+	WeekStart             string `json:"week_start"`           // First day of the week the sync window is aligned to
+	LookbackDays          int    `json:"lookback_days"`        // Days before the start of the current week to sync
+	LookaheadDays         int    `json:"lookahead_days"`       // Days after the end of the current week to sync
+	LookaheadWeeks        int    `json:"lookahead_weeks"`      // Weeks after the end of the current week to sync, added to lookahead_days
+	RemovalPolicyPast     string `json:"removal_policy_past"`  // What to do with started events that left Pike13: "delete", "cancel" or "mark"
+	RemovalPolicyFuture   string `json:"removal_policy_future"` // The same for events that have not started yet
+	FreezePastEvents      bool   `json:"freeze_past_events"`   // Never update or remove events that ended before freeze_grace ago
+	FreezeGrace           Duration `json:"freeze_grace"`       // How long after ending an event can still be changed
+	Filters               []FilterRule `json:"filters"`        // Which Pike13 events are synced; empty syncs all of them
+	SummaryTemplate       string `json:"summary_template"`     // Go text/template for event titles; empty uses the class name
+	DescriptionTemplate   string `json:"description_template"` // Go text/template for event descriptions; empty uses the built-in layout
+	LocationTemplate      string `json:"location_template"`    // Go text/template for event locations; empty leaves locations alone
+	ColorRules            []ColorRule `json:"color_rules"`     // Event colors by condition, first match wins; unmatched events are red, or gray when not active
+	InstanceID            string `json:"instance_id"`          // Identifies this deployment on a shared calendar; empty for a single deployment
+	AdoptUntagged         bool   `json:"adopt_untagged_events"` // Take over synced events that carry no instance ID (opt-in)
+	Force                 bool   `json:"-"` // Set by --force to bypass the deletion safeguards
+	ForceUpdate           bool   `json:"-"` // Set by --force-update to rewrite every event even if unchanged
 	BaseDir               string `json:"-"` // Not serialized
 }
 
 // LoadConfig loads configuration from file and environment variables
 func LoadConfig(configPath string) (*Config, error) {
 	config := &Config{
-		TimeZone: "America/Los_Angeles",
-		DryRun:   false,
+		TimeZone:           "America/Los_Angeles",
+		DryRun:             false,
+		CalendarMaxResults: 250,
+		Pike13PageSize:     100,
+		Pike13Retry: RetryConfig{
+			MaxAttempts: 4,
+			BaseDelay:   Duration{500 * time.Millisecond},
+			MaxDelay:    Duration{30 * time.Second},
+			Deadline:    Duration{2 * time.Minute},
+		},
+		CalendarRetry: RetryConfig{
+			MaxAttempts: 5,
+			BaseDelay:   Duration{time.Second},
+			MaxDelay:    Duration{32 * time.Second},
+			Deadline:    Duration{2 * time.Minute},
+		},
+		CalendarRetryBudget: 50,
+		CalendarConcurrency: 4,
+		CalendarQPS:         5,
+		CalendarBatchSize:   50,
+		MaxDeletes:          50,
+		MaxDeletePercent:    50,
+		EventIDNamespace:    "pike13sync",
+		DuplicatePolicy:     "delete",
+		ConflictPolicy:      "calendar",
+		WeekStart:           "sunday",
+		LookaheadWeeks:      1,
+		RemovalPolicyPast:   "delete",
+		RemovalPolicyFuture: "delete",
+		FreezeGrace:         Duration{24 * time.Hour},
 	}
 	
 	// Determine base directory
@@ -57,6 +186,13 @@ func LoadConfig(configPath string) (*Config, error) {
 		config.LogPath = filepath.Join(logsDir, "pike13sync.log")
 	}
 	
+	// State path from environment variable or default
+	config.StatePath = os.Getenv("STATE_PATH")
+	if config.StatePath == "" {
+		config.StatePath = filepath.Join(config.BaseDir, "state", "sync_state.json")
+	}
+	config.CalendarCachePath = filepath.Join(config.BaseDir, "state", "calendar_cache.json")
+	
 	// Create directories if they don't exist
 	os.MkdirAll(configDir, 0755)
 	os.MkdirAll(credentialsDir, 0755)
@@ -117,6 +253,16 @@ func loadConfigFromEnv(config *Config) {
 		config.LogPath = logPath
 	}
 	
+	// Instance ID from environment variable
+	if instanceID := os.Getenv("INSTANCE_ID"); instanceID != "" {
+		config.InstanceID = instanceID
+	}
+	
+	// State path from environment variable
+	if statePath := os.Getenv("STATE_PATH"); statePath != "" {
+		config.StatePath = statePath
+	}
+	
 	// Dry run from environment variable
 	if dryRunEnv := os.Getenv("DRY_RUN"); dryRunEnv != "" {
 		// Consider "true", "1", "yes", "y" as true values (case insensitive)
@@ -63,6 +63,10 @@ func TestLoadConfig(t *testing.T) {
 	if cfg.DryRun != true {
 		t.Errorf("Expected DryRun=true, got %v", cfg.DryRun)
 	}
+	// Adopting untagged events must be switched on for one deployment only
+	if cfg.AdoptUntagged {
+		t.Errorf("Expected AdoptUntagged=false by default, got %v", cfg.AdoptUntagged)
+	}
 	
 	// Test environment variable overrides
 	os.Setenv("PIKE13_URL", "https://override.pike13.com/api/v2")
@@ -0,0 +1,225 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+	"github.com/dcotelessa/pike13sync/internal/util"
+)
+
+// Rule actions
+const (
+	ActionInclude = "include"
+	ActionExclude = "exclude"
+)
+
+// NotIncluded is the rule reported for events left out because include rules
+// exist and none of them matched
+const NotIncluded = "no include rule matched"
+
+// Condition is a compiled config.EventCondition
+type Condition struct {
+	name         *regexp.Regexp
+	staff        map[string]bool // Lowercased staff names and IDs
+	states       map[string]bool // Lowercased states
+	weekdays     map[time.Weekday]bool
+	after        int // Minutes after midnight, or -1 when not set
+	before       int // Minutes after midnight, or -1 when not set
+	full         *bool
+	waitlistFull *bool
+	loc          *time.Location
+}
+
+// NewCondition validates and compiles a condition. Weekdays and times of day
+// are those of the class start in loc.
+func NewCondition(c config.EventCondition, loc *time.Location) (*Condition, error) {
+	cond := &Condition{after: -1, before: -1, loc: loc}
+	
+	if c.NamePattern != "" {
+		re, err := regexp.Compile(c.NamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name_pattern %q: %v", c.NamePattern, err)
+		}
+		cond.name = re
+	}
+	if len(c.Staff) > 0 {
+		cond.staff = lowerSet(c.Staff)
+	}
+	if len(c.States) > 0 {
+		cond.states = lowerSet(c.States)
+	}
+	if len(c.Weekdays) > 0 {
+		cond.weekdays = make(map[time.Weekday]bool)
+		for _, name := range c.Weekdays {
+			day, err := util.ParseWeekday(name)
+			if err != nil {
+				return nil, err
+			}
+			cond.weekdays[day] = true
+		}
+	}
+	
+	cond.full = c.Full
+	cond.waitlistFull = c.WaitlistFull
+	
+	var err error
+	if cond.after, err = parseTimeOfDay("after", c.After); err != nil {
+		return nil, err
+	}
+	if cond.before, err = parseTimeOfDay("before", c.Before); err != nil {
+		return nil, err
+	}
+	
+	// A condition without anything set would match every class
+	if cond.name == nil && cond.staff == nil && cond.states == nil && cond.weekdays == nil &&
+		cond.after < 0 && cond.before < 0 && cond.full == nil && cond.waitlistFull == nil {
+		return nil, fmt.Errorf("no conditions set")
+	}
+	return cond, nil
+}
+
+// Matches reports whether an event meets every part of the condition
+func (c *Condition) Matches(event pike13.Pike13Event) bool {
+	if c.name != nil && !c.name.MatchString(event.Name) {
+		return false
+	}
+	if c.states != nil && !c.states[strings.ToLower(event.State)] {
+		return false
+	}
+	if c.staff != nil && !c.matchesStaff(event.StaffMembers) {
+		return false
+	}
+	if c.full != nil && *c.full != event.Full {
+		return false
+	}
+	if c.waitlistFull != nil && *c.waitlistFull != event.Waitlist.Full {
+		return false
+	}
+	
+	if c.weekdays == nil && c.after < 0 && c.before < 0 {
+		return true
+	}
+	start, err := time.Parse(time.RFC3339, event.StartAt)
+	if err != nil {
+		// Without a start time the class cannot be on the right day or time
+		return false
+	}
+	start = start.In(c.loc)
+	if c.weekdays != nil && !c.weekdays[start.Weekday()] {
+		return false
+	}
+	return c.matchesTime(start.Hour()*60 + start.Minute())
+}
+
+// matchesStaff reports whether any staff member is listed by ID or name
+func (c *Condition) matchesStaff(staff []pike13.StaffMember) bool {
+	for _, member := range staff {
+		if c.staff[strconv.Itoa(member.ID)] || c.staff[strings.ToLower(member.Name)] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesTime checks a start time, in minutes after midnight, against after
+// and before. When after is later than before the range wraps past midnight.
+func (c *Condition) matchesTime(minute int) bool {
+	switch {
+	case c.after >= 0 && c.before >= 0 && c.after > c.before:
+		return minute >= c.after || minute < c.before
+	case c.after >= 0 && minute < c.after:
+		return false
+	case c.before >= 0 && minute >= c.before:
+		return false
+	}
+	return true
+}
+
+// Rule is a compiled filter rule
+type Rule struct {
+	Name   string
+	Action string
+	*Condition
+}
+
+// Filter decides which Pike13 events are synced. Exclude rules win over
+// include rules, and once any include rule exists only events matching one
+// of them are kept.
+type Filter struct {
+	includes []Rule
+	excludes []Rule
+}
+
+// New validates and compiles filter rules. Rules without a name are named
+// after their action and position, such as "exclude rule 2".
+func New(rules []config.FilterRule, loc *time.Location) (*Filter, error) {
+	f := &Filter{}
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("%s rule %d", r.Action, i+1)
+		}
+		
+		cond, err := NewCondition(r.EventCondition, loc)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %v", name, err)
+		}
+		
+		rule := Rule{Name: name, Action: r.Action, Condition: cond}
+		switch r.Action {
+		case ActionInclude:
+			f.includes = append(f.includes, rule)
+		case ActionExclude:
+			f.excludes = append(f.excludes, rule)
+		default:
+			return nil, fmt.Errorf("filter %q: unknown action %q (expected include or exclude)", name, r.Action)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether an event should be synced. For events that are not,
+// it also returns the name of the rule that filtered them out.
+func (f *Filter) Match(event pike13.Pike13Event) (bool, string) {
+	for _, rule := range f.excludes {
+		if rule.Matches(event) {
+			return false, rule.Name
+		}
+	}
+	if len(f.includes) == 0 {
+		return true, ""
+	}
+	for _, rule := range f.includes {
+		if rule.Matches(event) {
+			return true, ""
+		}
+	}
+	return false, NotIncluded
+}
+
+// lowerSet returns the lowercased values as a set
+func lowerSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[strings.ToLower(strings.TrimSpace(value))] = true
+	}
+	return set
+}
+
+// parseTimeOfDay parses an "HH:MM" time into minutes after midnight, or
+// returns -1 for an empty value
+func parseTimeOfDay(field, value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return -1, fmt.Errorf("invalid %s time %q (expected HH:MM)", field, value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
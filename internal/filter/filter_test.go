@@ -0,0 +1,130 @@
+package filter_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/filter"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+)
+
+// TestCondition tests each kind of condition against Pike13 events
+func TestCondition(t *testing.T) {
+	loc, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+	
+	// Monday 9:30 in Los Angeles
+	event := pike13.Pike13Event{
+		Name:         "Private Training",
+		State:        "active",
+		StartAt:      "2025-05-12T16:30:00Z",
+		StaffMembers: []pike13.StaffMember{{ID: 42, Name: "Jane Doe"}},
+		Waitlist:     pike13.Waitlist{Full: true},
+	}
+	yes, no := true, false
+	
+	tests := []struct {
+		name      string
+		condition config.EventCondition
+		want      bool
+	}{
+		{"Name pattern", config.EventCondition{NamePattern: "(?i)^private"}, true},
+		{"Name pattern mismatch", config.EventCondition{NamePattern: "Yoga"}, false},
+		{"Staff by name", config.EventCondition{Staff: []string{"jane doe"}}, true},
+		{"Staff by ID", config.EventCondition{Staff: []string{"42"}}, true},
+		{"Other staff", config.EventCondition{Staff: []string{"7", "John Roe"}}, false},
+		{"State", config.EventCondition{States: []string{"Active"}}, true},
+		{"Other state", config.EventCondition{States: []string{"canceled"}}, false},
+		{"Local weekday", config.EventCondition{Weekdays: []string{"mon", "wed"}}, true},
+		{"Other weekday", config.EventCondition{Weekdays: []string{"sunday"}}, false},
+		{"After", config.EventCondition{After: "09:30"}, true},
+		{"Too early", config.EventCondition{After: "10:00"}, false},
+		{"Before", config.EventCondition{Before: "10:00"}, true},
+		{"Too late", config.EventCondition{Before: "09:30"}, false},
+		{"Range", config.EventCondition{After: "06:00", Before: "12:00"}, true},
+		{"Range past midnight", config.EventCondition{After: "21:00", Before: "06:00"}, false},
+		{"All conditions", config.EventCondition{NamePattern: "Training", Staff: []string{"42"}, Weekdays: []string{"monday"}, After: "09:00"}, true},
+		{"One condition fails", config.EventCondition{NamePattern: "Training", Staff: []string{"7"}}, false},
+		{"Not full", config.EventCondition{Full: &no}, true},
+		{"Full", config.EventCondition{Full: &yes}, false},
+		{"Waitlist full", config.EventCondition{WaitlistFull: &yes}, true},
+	}
+	
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cond, err := filter.NewCondition(tc.condition, loc)
+			if err != nil {
+				t.Fatalf("NewCondition returned error: %v", err)
+			}
+			if got := cond.Matches(event); got != tc.want {
+				t.Errorf("Expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+// TestNewRejectsInvalidRules tests that configuration mistakes are reported
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.FilterRule
+	}{
+		{"Bad pattern", config.FilterRule{Action: filter.ActionExclude, EventCondition: config.EventCondition{NamePattern: "("}}},
+		{"Bad weekday", config.FilterRule{Action: filter.ActionExclude, EventCondition: config.EventCondition{Weekdays: []string{"funday"}}}},
+		{"Bad time", config.FilterRule{Action: filter.ActionExclude, EventCondition: config.EventCondition{After: "9am"}}},
+		{"Bad action", config.FilterRule{Action: "drop", EventCondition: config.EventCondition{NamePattern: "Yoga"}}},
+		{"No conditions", config.FilterRule{Action: filter.ActionExclude}},
+	}
+	
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := filter.New([]config.FilterRule{tc.rule}, time.UTC); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestMatch tests that exclude rules win over include rules
+func TestMatch(t *testing.T) {
+	f, err := filter.New([]config.FilterRule{
+		{Action: filter.ActionInclude, EventCondition: config.EventCondition{States: []string{"active"}}},
+		{Name: "Private Training", Action: filter.ActionExclude, EventCondition: config.EventCondition{NamePattern: "Private"}},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	
+	tests := []struct {
+		event pike13.Pike13Event
+		keep  bool
+		rule  string
+	}{
+		{pike13.Pike13Event{Name: "Yoga", State: "active"}, true, ""},
+		{pike13.Pike13Event{Name: "Private Session", State: "active"}, false, "Private Training"},
+		{pike13.Pike13Event{Name: "Yoga", State: "canceled"}, false, filter.NotIncluded},
+	}
+	for _, tc := range tests {
+		keep, rule := f.Match(tc.event)
+		if keep != tc.keep || rule != tc.rule {
+			t.Errorf("%s (%s): expected %v %q, got %v %q", tc.event.Name, tc.event.State, tc.keep, tc.rule, keep, rule)
+		}
+	}
+	
+	// Without include rules everything not excluded is kept
+	f, err = filter.New([]config.FilterRule{
+		{Action: filter.ActionExclude, EventCondition: config.EventCondition{Staff: []string{"Staff Only"}}},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if keep, _ := f.Match(pike13.Pike13Event{Name: "Yoga"}); !keep {
+		t.Error("Expected an event matching no rule to be kept")
+	}
+	if keep, rule := f.Match(pike13.Pike13Event{StaffMembers: []pike13.StaffMember{{Name: "staff only"}}}); keep || rule != "exclude rule 1" {
+		t.Errorf("Expected the default rule name, got %v %q", keep, rule)
+	}
+}
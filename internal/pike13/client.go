@@ -1,11 +1,13 @@
 package pike13
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 
@@ -16,13 +18,17 @@ import (
 // Client handles interactions with Pike13 API
 type Client struct {
 	config     *config.Config
+	httpClient *http.Client
 	testHeader map[string]string // For testing purposes only
 }
 
 // NewClient creates a new Pike13 client
 func NewClient(config *config.Config) *Client {
 	return &Client{
-		config:     config,
+		config: config,
+		httpClient: &http.Client{
+			Transport: NewRetryTransport(http.DefaultTransport, config.Pike13Retry),
+		},
 		testHeader: make(map[string]string),
 	}
 }
@@ -36,7 +42,12 @@ func (c *Client) SetTestHeader(key, value string) {
 	c.testHeader[key] = value
 }
 
-// FetchEvents retrieves events from Pike13 API
+// maxPages guards against a paging loop that never terminates
+const maxPages = 1000
+
+// FetchEvents retrieves events from Pike13 API, following pagination until
+// every occurrence in the range has been fetched. A failed or missing page is
+// an error; a partial result is never returned.
 func (c *Client) FetchEvents(fromDate, toDate string) (Pike13Response, error) {
 	var response Pike13Response
 	
@@ -47,18 +58,114 @@ func (c *Client) FetchEvents(fromDate, toDate string) (Pike13Response, error) {
 		// Continue without credentials
 	}
 	
-	// Construct the URL with query parameters
-	url := fmt.Sprintf("%s?from=%s&to=%s", c.config.Pike13URL, fromDate, toDate)
+	// Construct the URL with query parameters, escaped so offsets such as
+	// "+02:00" are not read as spaces
+	query := url.Values{}
+	query.Set("from", fromDate)
+	query.Set("to", toDate)
 	
 	// Add client_id if available
 	if pike13Creds.ClientID != "" {
-		url = fmt.Sprintf("%s&client_id=%s", url, pike13Creds.ClientID)
+		query.Set("client_id", pike13Creds.ClientID)
+	}
+	baseURL := c.config.Pike13URL + "?" + query.Encode()
+	
+	// One retry deadline covers every page, so paging cannot stretch it
+	ctx := context.Background()
+	if deadline := c.config.Pike13Retry.Deadline.Duration; deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, deadline)
+		defer cancel()
 	}
 	
-	log.Printf("Requesting URL: %s", url)
+	seen := make(map[int]bool)
+	pageURL := c.pageURL(baseURL, 1)
+	for page := 1; ; page++ {
+		if page > maxPages {
+			return Pike13Response{}, fmt.Errorf("pagination did not finish after %d pages", maxPages)
+		}
+		
+		pageResponse, err := c.fetchPage(ctx, pageURL, page)
+		if err != nil {
+			return Pike13Response{}, fmt.Errorf("error fetching page %d: %v", page, err)
+		}
+		
+		// Merge, ignoring occurrences repeated across page boundaries
+		added := 0
+		for _, event := range pageResponse.EventOccurrences {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			response.EventOccurrences = append(response.EventOccurrences, event)
+			added++
+		}
+		if pageResponse.TotalCount > response.TotalCount {
+			response.TotalCount = pageResponse.TotalCount
+		}
+		
+		// Prefer an explicit link to the next page, unless following it
+		// only brings back occurrences already seen
+		if pageResponse.Next != "" {
+			if added == 0 {
+				return Pike13Response{}, fmt.Errorf("pagination made no progress: page %d added no new event occurrences", page)
+			}
+			nextURL, err := resolveURL(pageURL, pageResponse.Next)
+			if err != nil {
+				return Pike13Response{}, fmt.Errorf("invalid next page link %q: %v", pageResponse.Next, err)
+			}
+			pageURL = nextURL
+			continue
+		}
+		
+		// Otherwise keep paging while the total count says there is more. A
+		// page adding nothing new means paging is ignored, so asking again
+		// would only repeat it.
+		if added > 0 && response.TotalCount > len(response.EventOccurrences) {
+			pageURL = c.pageURL(baseURL, page+1)
+			continue
+		}
+		
+		break
+	}
+	
+	if response.TotalCount > len(response.EventOccurrences) {
+		return Pike13Response{}, fmt.Errorf("incomplete results: received %d of %d event occurrences",
+			len(response.EventOccurrences), response.TotalCount)
+	}
+	
+	return response, nil
+}
+
+// pageURL adds paging parameters to the base request URL
+func (c *Client) pageURL(baseURL string, page int) string {
+	if c.config.Pike13PageSize <= 0 {
+		return baseURL
+	}
+	return fmt.Sprintf("%s&page=%d&per_page=%d", baseURL, page, c.config.Pike13PageSize)
+}
+
+// resolveURL resolves a possibly relative link against the current page URL
+func resolveURL(current, link string) (string, error) {
+	base, err := url.Parse(current)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// fetchPage retrieves and decodes a single page of event occurrences
+func (c *Client) fetchPage(ctx context.Context, pageURL string, page int) (Pike13Response, error) {
+	var response Pike13Response
+	
+	log.Printf("Requesting URL: %s", pageURL)
 	
 	// Make the HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
 	if err != nil {
 		return response, fmt.Errorf("error creating HTTP request: %v", err)
 	}
@@ -72,9 +179,8 @@ func (c *Client) FetchEvents(fromDate, toDate string) (Pike13Response, error) {
 		req.Header.Add(k, v)
 	}
 	
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// Send the request; transient failures are retried by the transport
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return response, fmt.Errorf("error making HTTP request: %v", err)
 	}
@@ -95,7 +201,11 @@ func (c *Client) FetchEvents(fromDate, toDate string) (Pike13Response, error) {
 	// Save a copy of the raw JSON for debugging
 	if c.config.LogPath != "" {
 		logDir := filepath.Dir(c.config.LogPath)
-		err = os.WriteFile(filepath.Join(logDir, "pike13_response.json"), body, 0644)
+		fileName := "pike13_response.json"
+		if page > 1 {
+			fileName = fmt.Sprintf("pike13_response_page%d.json", page)
+		}
+		err = os.WriteFile(filepath.Join(logDir, fileName), body, 0644)
 		if err != nil {
 			log.Printf("Warning: Could not save raw API response: %v", err)
 		}
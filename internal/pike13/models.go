@@ -3,6 +3,10 @@ package pike13
 // Pike13Response represents the response from Pike13 API
 type Pike13Response struct {
 	EventOccurrences []Pike13Event `json:"event_occurrences"`
+	
+	// Paging metadata; absent when everything fits in one response
+	TotalCount int    `json:"total_count,omitempty"`
+	Next       string `json:"next,omitempty"`
 }
 
 // Pike13Event represents an event from Pike13
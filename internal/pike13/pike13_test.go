@@ -1,10 +1,15 @@
 package pike13_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 	
 	"github.com/dcotelessa/pike13sync/internal/config"
 	"github.com/dcotelessa/pike13sync/internal/pike13"
@@ -130,3 +135,324 @@ func TestFetchEvents(t *testing.T) {
 		t.Error("Expected error for invalid URL, got nil")
 	}
 }
+
+// pagedServer serves totalEvents occurrences in pages, either linked with
+// "next" or described only by "total_count". Pages listed in missing fail.
+func pagedServer(t *testing.T, totalEvents int, useNextLink bool, missing map[int]bool) (*httptest.Server, *int) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		if page < 1 || perPage < 1 {
+			t.Errorf("Missing paging parameters in %s", r.URL.RawQuery)
+			http.Error(w, "missing paging parameters", http.StatusBadRequest)
+			return
+		}
+		if missing[page] {
+			http.Error(w, "page unavailable", http.StatusNotFound)
+			return
+		}
+		
+		response := pike13.Pike13Response{TotalCount: totalEvents}
+		for id := (page-1)*perPage + 1; id <= page*perPage && id <= totalEvents; id++ {
+			response.EventOccurrences = append(response.EventOccurrences, pike13.Pike13Event{
+				ID:   id,
+				Name: fmt.Sprintf("Class %d", id),
+			})
+		}
+		if useNextLink && page*perPage < totalEvents {
+			query := r.URL.Query()
+			query.Set("page", strconv.Itoa(page+1))
+			response.Next = "?" + query.Encode()
+		}
+		
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+// TestFetchEventsPagination tests that FetchEvents follows Pike13 paging metadata
+func TestFetchEventsPagination(t *testing.T) {
+	testCases := []struct {
+		name        string
+		useNextLink bool
+	}{
+		{name: "Next links", useNextLink: true},
+		{name: "Total count only", useNextLink: false},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, requests := pagedServer(t, 7, tc.useNextLink, nil)
+			
+			cfg := &config.Config{Pike13URL: ts.URL, Pike13PageSize: 3}
+			client := pike13.NewClient(cfg)
+			
+			response, err := client.FetchEvents("2025-05-01T00:00:00Z", "2025-05-31T00:00:00Z")
+			if err != nil {
+				t.Fatalf("FetchEvents returned error: %v", err)
+			}
+			
+			if len(response.EventOccurrences) != 7 {
+				t.Fatalf("Expected 7 events across all pages, got %d", len(response.EventOccurrences))
+			}
+			for i, event := range response.EventOccurrences {
+				if event.ID != i+1 {
+					t.Errorf("Expected event %d to have ID %d, got %d", i, i+1, event.ID)
+				}
+			}
+			if *requests != 3 {
+				t.Errorf("Expected 3 page requests, got %d", *requests)
+			}
+		})
+	}
+}
+
+// TestFetchEventsMissingPage tests that a missing page fails instead of returning a partial set
+func TestFetchEventsMissingPage(t *testing.T) {
+	ts, _ := pagedServer(t, 7, false, map[int]bool{2: true})
+	
+	cfg := &config.Config{Pike13URL: ts.URL, Pike13PageSize: 3}
+	client := pike13.NewClient(cfg)
+	
+	response, err := client.FetchEvents("2025-05-01T00:00:00Z", "2025-05-31T00:00:00Z")
+	if err == nil {
+		t.Fatal("Expected error for missing page, got nil")
+	}
+	if len(response.EventOccurrences) != 0 {
+		t.Errorf("Expected no partial results, got %d events", len(response.EventOccurrences))
+	}
+}
+
+// TestFetchEventsNoProgress tests that paging stops as soon as a page adds no
+// new occurrences instead of requesting the same page again and again
+func TestFetchEventsNoProgress(t *testing.T) {
+	testCases := []struct {
+		name          string
+		pageSize      int
+		useNextLink   bool
+		expectedError string
+	}{
+		{name: "Total count, page size 3", pageSize: 3, expectedError: "incomplete results"},
+		{name: "Total count, page size 0", pageSize: 0, expectedError: "incomplete results"},
+		{name: "Next link", pageSize: 3, useNextLink: true, expectedError: "pagination made no progress"},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				// Paging parameters are ignored and the first page always comes back
+				w.Header().Set("Content-Type", "application/json")
+				if tc.useNextLink {
+					w.Write([]byte(`{"event_occurrences": [{"id": 1}, {"id": 2}], "next": "?page=2"}`))
+					return
+				}
+				w.Write([]byte(`{"event_occurrences": [{"id": 1}, {"id": 2}], "total_count": 3}`))
+			}))
+			defer ts.Close()
+			
+			cfg := &config.Config{Pike13URL: ts.URL, Pike13PageSize: tc.pageSize}
+			response, err := pike13.NewClient(cfg).FetchEvents("2025-05-01T00:00:00Z", "2025-05-31T00:00:00Z")
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("Expected a %q error, got %v", tc.expectedError, err)
+			}
+			if len(response.EventOccurrences) != 0 {
+				t.Errorf("Expected no partial results, got %d events", len(response.EventOccurrences))
+			}
+			if requests != 2 {
+				t.Errorf("Expected 2 requests, got %d", requests)
+			}
+		})
+	}
+}
+
+// TestFetchEventsWindowOffset tests that a window with a UTC offset reaches Pike13 intact
+func TestFetchEventsWindowOffset(t *testing.T) {
+	fromDate, toDate := "2025-05-12T00:00:00+02:00", "2025-05-19T00:00:00+02:00"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to"); from != fromDate || to != toDate {
+			t.Errorf("Expected window %s to %s, got %s to %s", fromDate, toDate, from, to)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pike13.Pike13Response{})
+	}))
+	defer ts.Close()
+	
+	client := pike13.NewClient(&config.Config{Pike13URL: ts.URL})
+	if _, err := client.FetchEvents(fromDate, toDate); err != nil {
+		t.Fatalf("FetchEvents returned error: %v", err)
+	}
+}
+
+// flappingServer fails the first failures requests with status, then serves one event
+func flappingServer(t *testing.T, failures int, status int, retryAfter string) (*httptest.Server, *int) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			http.Error(w, "temporarily unavailable", status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"event_occurrences": [{"id": 1, "name": "Test Class"}]}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &requests
+}
+
+// TestFetchEventsRetry tests retrying of transient Pike13 failures
+func TestFetchEventsRetry(t *testing.T) {
+	fastRetry := config.RetryConfig{
+		MaxAttempts: 4,
+		BaseDelay:   config.Duration{Duration: time.Millisecond},
+		MaxDelay:    config.Duration{Duration: 5 * time.Millisecond},
+		Deadline:    config.Duration{Duration: 5 * time.Second},
+	}
+	
+	testCases := []struct {
+		name             string
+		failures         int
+		status           int
+		retryAfter       string
+		retry            config.RetryConfig
+		expectError      bool
+		expectedRequests int
+		minDuration      time.Duration
+		maxDuration      time.Duration
+	}{
+		{
+			name:             "Recovers from 503s",
+			failures:         2,
+			status:           http.StatusServiceUnavailable,
+			retry:            fastRetry,
+			expectedRequests: 3,
+		},
+		{
+			name:             "Honors Retry-After on 429",
+			failures:         1,
+			status:           http.StatusTooManyRequests,
+			retryAfter:       "1",
+			retry:            fastRetry,
+			expectedRequests: 2,
+			minDuration:      time.Second,
+		},
+		{
+			name:             "Gives up after max attempts",
+			failures:         10,
+			status:           http.StatusBadGateway,
+			retry:            fastRetry,
+			expectError:      true,
+			expectedRequests: 4,
+		},
+		{
+			name:             "Does not retry permanent errors",
+			failures:         1,
+			status:           http.StatusUnauthorized,
+			retry:            fastRetry,
+			expectError:      true,
+			expectedRequests: 1,
+		},
+		{
+			name:       "Stops at the deadline",
+			failures:   10,
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "30",
+			retry: config.RetryConfig{
+				MaxAttempts: 4,
+				BaseDelay:   config.Duration{Duration: time.Millisecond},
+				Deadline:    config.Duration{Duration: 100 * time.Millisecond},
+			},
+			expectError:      true,
+			expectedRequests: 1,
+			maxDuration:      5 * time.Second,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, requests := flappingServer(t, tc.failures, tc.status, tc.retryAfter)
+			
+			cfg := &config.Config{Pike13URL: ts.URL, Pike13Retry: tc.retry}
+			client := pike13.NewClient(cfg)
+			
+			start := time.Now()
+			response, err := client.FetchEvents("2025-05-01T00:00:00Z", "2025-05-31T00:00:00Z")
+			elapsed := time.Since(start)
+			
+			if tc.expectError && err == nil {
+				t.Error("Expected error, got nil")
+			}
+			if !tc.expectError {
+				if err != nil {
+					t.Fatalf("FetchEvents returned error: %v", err)
+				}
+				if len(response.EventOccurrences) != 1 {
+					t.Errorf("Expected 1 event, got %d", len(response.EventOccurrences))
+				}
+			}
+			if *requests != tc.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", tc.expectedRequests, *requests)
+			}
+			if elapsed < tc.minDuration {
+				t.Errorf("Expected to wait at least %s, took %s", tc.minDuration, elapsed)
+			}
+			if tc.maxDuration > 0 && elapsed > tc.maxDuration {
+				t.Errorf("Expected to finish within %s, took %s", tc.maxDuration, elapsed)
+			}
+		})
+	}
+}
+
+// TestFetchEventsRetryDeadlineAcrossPages tests that the retry deadline covers
+// the whole fetch rather than each page request
+func TestFetchEventsRetryDeadlineAcrossPages(t *testing.T) {
+	attempts := make(map[int]int)
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		// Every page fails once before it is served
+		attempts[page]++
+		if attempts[page] == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "temporarily unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"event_occurrences": [{"id": %d}], "total_count": 3}`, page)
+	}))
+	defer ts.Close()
+	
+	// Each page fits in the deadline on its own, but not all three together
+	cfg := &config.Config{
+		Pike13URL:      ts.URL,
+		Pike13PageSize: 1,
+		Pike13Retry: config.RetryConfig{
+			MaxAttempts: 4,
+			BaseDelay:   config.Duration{Duration: time.Millisecond},
+			Deadline:    config.Duration{Duration: 1500 * time.Millisecond},
+		},
+	}
+	
+	start := time.Now()
+	_, err := pike13.NewClient(cfg).FetchEvents("2025-05-01T00:00:00Z", "2025-05-31T00:00:00Z")
+	elapsed := time.Since(start)
+	
+	if err == nil {
+		t.Fatal("Expected the fetch to run out of time, got nil")
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests before the deadline, got %d", requests)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Expected to stop within the deadline, took %s", elapsed)
+	}
+}
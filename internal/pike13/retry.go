@@ -0,0 +1,134 @@
+package pike13
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/util"
+)
+
+// RetryTransport is an http.RoundTripper that retries transient failures
+// (network errors, 429 and 5xx responses) with jittered exponential backoff,
+// honoring Retry-After and an overall deadline
+type RetryTransport struct {
+	Base   http.RoundTripper
+	Config config.RetryConfig
+}
+
+// NewRetryTransport wraps base (http.DefaultTransport when nil) with retries
+func NewRetryTransport(base http.RoundTripper, retryConfig config.RetryConfig) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{
+		Base:   base,
+		Config: retryConfig,
+	}
+}
+
+// RoundTrip sends the request, retrying while the failure is transient and
+// the attempt and time budgets allow. When retries run out the last response
+// or error is returned unchanged.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	maxAttempts := t.Config.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	// A request body can only be replayed if it can be recreated
+	if req.Body != nil && req.GetBody == nil {
+		maxAttempts = 1
+	}
+	
+	// The deadline covers every attempt. A deadline already on the request
+	// context, such as the one FetchEvents shares across all pages, wins.
+	deadline, hasDeadline := req.Context().Deadline()
+	if !hasDeadline && t.Config.Deadline.Duration > 0 {
+		deadline, hasDeadline = time.Now().Add(t.Config.Deadline.Duration), true
+	}
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("error recreating request body: %v", err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		
+		resp, err := t.Base.RoundTrip(attemptReq)
+		if !shouldRetry(resp, err) || attempt >= maxAttempts {
+			return resp, err
+		}
+		
+		// Work out how long to wait before the next attempt
+		delay := util.BackoffDelay(t.Config.BaseDelay.Duration, t.Config.MaxDelay.Duration, attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+		}
+		
+		if hasDeadline && time.Now().Add(delay).After(deadline) {
+			log.Printf("Pike13 request failed (%s); retry deadline reached after %d attempt(s)", reason, attempt)
+			return resp, err
+		}
+		
+		// Discard the failed response before trying again
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.Printf("Pike13 request failed (%s), attempt %d/%d; retrying in %s",
+			reason, attempt, maxAttempts, delay.Round(time.Millisecond))
+		
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a response or error is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
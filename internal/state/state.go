@@ -0,0 +1,172 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Version is the format of the state file written by this build
+const Version = 1
+
+// MaxRuns is how many runs are kept in the history
+const MaxRuns = 50
+
+// Entry is what pike13sync remembers about one Pike13 event occurrence
+type Entry struct {
+	EventID     string    `json:"event_id"`               // Google Calendar event ID
+	Hash        string    `json:"hash"`                   // Content hash of the event as last synced
+	Pike13State string    `json:"pike13_state,omitempty"` // Pike13 state when last synced (active, canceled, ...)
+	Summary     string    `json:"summary"`
+	Start       string    `json:"start"` // RFC3339 start time
+	FirstSynced time.Time `json:"first_synced"`
+	LastSynced  time.Time `json:"last_synced"`
+}
+
+// Run records the outcome of one sync run
+type Run struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Command    string    `json:"command"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	FromState  bool      `json:"from_state,omitempty"` // The calendar listing failed and the state was used instead
+	Created    int       `json:"created"`
+	Updated    int       `json:"updated"`
+	Deleted    int       `json:"deleted"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// State is the local record of what has been synced, keyed by Pike13 occurrence ID
+type State struct {
+	Version int               `json:"version"`
+	Events  map[string]*Entry `json:"events"`
+	Runs    []Run             `json:"runs"`
+	
+	path string
+}
+
+// New returns an empty state that will be saved to path
+func New(path string) *State {
+	return &State{
+		Version: Version,
+		Events:  make(map[string]*Entry),
+		path:    path,
+	}
+}
+
+// Load reads the state file at path. A missing file gives an empty state.
+func Load(path string) (*State, error) {
+	st := New(path)
+	
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+	
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("error parsing state file %s: %v", path, err)
+	}
+	if st.Version > Version {
+		return nil, fmt.Errorf("state file %s has version %d, this build only understands %d", path, st.Version, Version)
+	}
+	if st.Events == nil {
+		st.Events = make(map[string]*Entry)
+	}
+	st.Version = Version
+	return st, nil
+}
+
+// Path returns the file the state is saved to
+func (s *State) Path() string {
+	return s.path
+}
+
+// Save writes the state to its file. The file is replaced atomically so an
+// interrupted run never leaves a truncated state behind.
+func (s *State) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+	
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding state: %v", err)
+	}
+	
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing state file: %v", err)
+	}
+	return nil
+}
+
+// Reset forgets every event and run
+func (s *State) Reset() {
+	s.Events = make(map[string]*Entry)
+	s.Runs = nil
+}
+
+// Get returns the entry for a Pike13 occurrence ID
+func (s *State) Get(pike13ID string) (*Entry, bool) {
+	entry, ok := s.Events[pike13ID]
+	return entry, ok
+}
+
+// Record stores the synced state of an event, keeping its first sync time
+func (s *State) Record(pike13ID string, entry Entry, now time.Time) {
+	entry.LastSynced = now
+	entry.FirstSynced = now
+	if previous, ok := s.Events[pike13ID]; ok && !previous.FirstSynced.IsZero() {
+		entry.FirstSynced = previous.FirstSynced
+	}
+	s.Events[pike13ID] = &entry
+}
+
+// Remove forgets an event
+func (s *State) Remove(pike13ID string) {
+	delete(s.Events, pike13ID)
+}
+
+// IDs returns the known Pike13 occurrence IDs ordered by start time
+func (s *State) IDs() []string {
+	ids := make([]string, 0, len(s.Events))
+	for id := range s.Events {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if a, b := s.Events[ids[i]].Start, s.Events[ids[j]].Start; a != b {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// AddRun appends a run to the history, dropping the oldest beyond MaxRuns
+func (s *State) AddRun(run Run) {
+	s.Runs = append(s.Runs, run)
+	if len(s.Runs) > MaxRuns {
+		s.Runs = s.Runs[len(s.Runs)-MaxRuns:]
+	}
+}
+
+// LastRun returns the most recent run, if any
+func (s *State) LastRun() (Run, bool) {
+	if len(s.Runs) == 0 {
+		return Run{}, false
+	}
+	return s.Runs[len(s.Runs)-1], true
+}
@@ -0,0 +1,105 @@
+package state_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/state"
+)
+
+// TestLoadMissingFile tests that a missing state file gives an empty state
+func TestLoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "sync_state.json")
+	
+	st, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if len(st.Events) != 0 || len(st.Runs) != 0 {
+		t.Errorf("Expected empty state, got %d events and %d runs", len(st.Events), len(st.Runs))
+	}
+	if st.Path() != path {
+		t.Errorf("Expected path %s, got %s", path, st.Path())
+	}
+}
+
+// TestSaveAndLoad tests that entries and runs survive a round trip
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "sync_state.json")
+	first := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := first.Add(24 * time.Hour)
+	
+	st := state.New(path)
+	st.Record("42", state.Entry{EventID: "evt42", Hash: "abc", Summary: "Class", Start: "2025-05-12T17:00:00Z"}, first)
+	st.Record("42", state.Entry{EventID: "evt42", Hash: "def", Summary: "Class", Start: "2025-05-12T17:00:00Z"}, later)
+	st.AddRun(state.Run{Command: "sync", Created: 1})
+	if err := st.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected temporary file to be renamed away")
+	}
+	
+	loaded, err := state.Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	entry, ok := loaded.Get("42")
+	if !ok {
+		t.Fatal("Expected entry 42 after loading")
+	}
+	if entry.Hash != "def" || !entry.FirstSynced.Equal(first) || !entry.LastSynced.Equal(later) {
+		t.Errorf("Unexpected entry after reload: %+v", entry)
+	}
+	if run, ok := loaded.LastRun(); !ok || run.Created != 1 {
+		t.Errorf("Expected last run with 1 create, got %+v", run)
+	}
+}
+
+// TestLoadNewerVersion tests that a state written by a newer build is refused
+func TestLoadNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync_state.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99, "events": {}}`), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+	
+	if _, err := state.Load(path); err == nil {
+		t.Error("Expected error for a newer state version, got nil")
+	}
+}
+
+// TestRunHistoryLimit tests that only the most recent runs are kept
+func TestRunHistoryLimit(t *testing.T) {
+	st := state.New(filepath.Join(t.TempDir(), "sync_state.json"))
+	for i := 0; i < state.MaxRuns+5; i++ {
+		st.AddRun(state.Run{Created: i})
+	}
+	
+	if len(st.Runs) != state.MaxRuns {
+		t.Fatalf("Expected %d runs, got %d", state.MaxRuns, len(st.Runs))
+	}
+	if st.Runs[0].Created != 5 {
+		t.Errorf("Expected oldest kept run to be run 5, got %d", st.Runs[0].Created)
+	}
+	
+	st.Reset()
+	if len(st.Runs) != 0 || len(st.Events) != 0 {
+		t.Error("Expected Reset to clear events and runs")
+	}
+}
+
+// TestIDsOrderedByStart tests that IDs are listed in start time order
+func TestIDsOrderedByStart(t *testing.T) {
+	st := state.New(filepath.Join(t.TempDir(), "sync_state.json"))
+	now := time.Now()
+	st.Record("3", state.Entry{Start: "2025-05-14T17:00:00Z"}, now)
+	st.Record("1", state.Entry{Start: "2025-05-12T17:00:00Z"}, now)
+	st.Record("2", state.Entry{Start: "2025-05-12T17:00:00Z"}, now)
+	
+	ids := st.IDs()
+	if len(ids) != 3 || ids[0] != "1" || ids[1] != "2" || ids[2] != "3" {
+		t.Errorf("Expected [1 2 3], got %v", ids)
+	}
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+	"github.com/dcotelessa/pike13sync/internal/config"
+)
+
+// Conflict policies, deciding what happens to synced events edited by hand
+// in Google Calendar
+const (
+	ConflictPolicyPike13   = "pike13"   // Overwrite the edits with Pike13 data
+	ConflictPolicyCalendar = "calendar" // Accept the edits once and ignore Pike13 changes to the event (default)
+	ConflictPolicySkip     = "skip"     // Leave the event alone and flag it on every run
+)
+
+// How a conflict was resolved
+const (
+	ResolutionOverwritten = "overwritten"
+	ResolutionKept        = "kept"
+	ResolutionSkipped     = "skipped"
+)
+
+// Conflict is a synced event that was changed outside pike13sync since it
+// was last written
+type Conflict struct {
+	Pike13ID      string `json:"pike13_id"`
+	EventID       string `json:"event_id"`
+	Summary       string `json:"summary"` // As currently shown in the calendar
+	Start         string `json:"start"`
+	Pike13Changed bool   `json:"pike13_changed"` // Pike13 changed the event as well
+	Resolution    string `json:"resolution"`
+}
+
+// checkConflictPolicy reports a conflict policy that is not one of the known
+// ones, so a typo does not quietly drop Pike13 changes to edited events
+func checkConflictPolicy(cfg *config.Config) error {
+	switch cfg.ConflictPolicy {
+	case ConflictPolicyPike13, ConflictPolicyCalendar, ConflictPolicySkip:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict_policy %q (expected pike13, calendar or skip)", cfg.ConflictPolicy)
+}
+
+// resolveConflict decides what to do with an edited event, records the
+// conflict on the plan and returns its resolution. --force-update always
+// lets Pike13 win.
+func (s *SyncService) resolveConflict(plan *SyncPlan, pike13ID string, event *calendar.Event, pike13Changed bool) string {
+	conflict := Conflict{
+		Pike13ID:      pike13ID,
+		EventID:       event.Id,
+		Summary:       event.Summary,
+		Start:         startOf(event),
+		Pike13Changed: pike13Changed,
+	}
+	
+	policy := s.config.ConflictPolicy
+	if s.config.ForceUpdate {
+		policy = ConflictPolicyPike13
+	}
+	
+	switch policy {
+	case ConflictPolicyPike13:
+		conflict.Resolution = ResolutionOverwritten
+		log.Printf("Event '%s' (Pike13 ID %s) was edited in Google Calendar; overwriting it with Pike13 data", event.Summary, pike13ID)
+	case ConflictPolicySkip:
+		conflict.Resolution = ResolutionSkipped
+		log.Printf("Warning: event '%s' (Pike13 ID %s) was edited in Google Calendar; skipping it until the edit is resolved", event.Summary, pike13ID)
+	default:
+		// The edit is accepted, over any Pike13 changes
+		conflict.Resolution = ResolutionKept
+		if pike13Changed {
+			log.Printf("Event '%s' (Pike13 ID %s) was edited in Google Calendar; keeping the edit over Pike13 changes", event.Summary, pike13ID)
+		} else {
+			log.Printf("Event '%s' (Pike13 ID %s) was edited in Google Calendar; keeping the edit", event.Summary, pike13ID)
+		}
+	}
+	
+	plan.Conflicts = append(plan.Conflicts, conflict)
+	return conflict.Resolution
+}
+
+// planAccept returns the operation that accepts an edit made in Google
+// Calendar. Only the private properties change: the stored hash is set to
+// the edited content, so the event no longer counts as edited, and the hash
+// of the Pike13 data is kept to notice later Pike13 changes.
+func planAccept(pike13ID string, event *calendar.Event, pike13Hash, pike13State string) Operation {
+	accepted := *event
+	private := map[string]string{}
+	if event.ExtendedProperties != nil {
+		for key, value := range event.ExtendedProperties.Private {
+			private[key] = value
+		}
+	}
+	private[calendar.PropertyAccepted] = pike13Hash
+	accepted.ExtendedProperties = &calendar.ExtendedProperties{Private: private}
+	private[calendar.PropertyHash] = calendar.ContentHash(&accepted)
+	
+	return Operation{
+		Kind:        OpAccept,
+		Pike13ID:    pike13ID,
+		EventID:     event.Id,
+		Summary:     event.Summary,
+		Event:       &accepted,
+		Diffs:       []FieldDiff{{Field: calendar.PropertyHash, Old: calendar.StoredHash(event), New: private[calendar.PropertyHash]}},
+		Hash:        pike13Hash,
+		Pike13State: pike13State,
+	}
+}
@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+	"github.com/dcotelessa/pike13sync/internal/config"
+)
+
+// Duplicate policies
+const (
+	DuplicatePolicyDelete = "delete" // Delete extra copies of a synced event
+	DuplicatePolicyReport = "report" // Only report them
+)
+
+// Duplicate is an extra calendar event for a Pike13 occurrence that already has one
+type Duplicate struct {
+	Pike13ID    string `json:"pike13_id"`
+	EventID     string `json:"event_id"`      // The extra copy
+	KeptEventID string `json:"kept_event_id"` // The canonical event that stays
+	Summary     string `json:"summary"`
+	Start       string `json:"start"`
+	End         string `json:"end,omitempty"`
+	Frozen      bool   `json:"frozen,omitempty"` // Kept because freeze_past_events protects it
+}
+
+// checkDuplicatePolicy reports a duplicate policy that is not one of the
+// known ones, so a typo meant to only report duplicates does not delete them
+func checkDuplicatePolicy(cfg *config.Config) error {
+	switch cfg.DuplicatePolicy {
+	case DuplicatePolicyDelete, DuplicatePolicyReport:
+		return nil
+	}
+	return fmt.Errorf("unknown duplicate_policy %q (expected delete or report)", cfg.DuplicatePolicy)
+}
+
+// groupExisting indexes synced events inside the window by Pike13 ID. When an
+// occurrence has several events, the canonical one is indexed and the others
+// are returned as duplicates.
+func (s *SyncService) groupExisting(events []*calendar.Event, window syncWindow) (map[string]*calendar.Event, []Duplicate) {
+	groups := make(map[string][]*calendar.Event)
+	for _, event := range events {
+		// The listing is already filtered server-side, but double-check the
+		// Pike13 properties before treating an event as ours
+		pike13ID := pike13IDOf(event)
+		if pike13ID == "" {
+			continue
+		}
+		// Leave events belonging to other deployments on a shared calendar alone
+		if !s.owns(event) {
+			continue
+		}
+		// The calendar returns anything overlapping the window, so ignore
+		// events that start outside of it
+		if !window.containsEvent(event) {
+			continue
+		}
+		groups[pike13ID] = append(groups[pike13ID], event)
+	}
+	
+	existing := make(map[string]*calendar.Event)
+	var duplicates []Duplicate
+	for pike13ID, group := range groups {
+		kept := s.canonicalEvent(pike13ID, group)
+		existing[pike13ID] = kept
+		for _, event := range group {
+			if event == kept {
+				continue
+			}
+			duplicates = append(duplicates, Duplicate{
+				Pike13ID:    pike13ID,
+				EventID:     event.Id,
+				KeptEventID: kept.Id,
+				Summary:     event.Summary,
+				Start:       startOf(event),
+				End:         endOf(event),
+			})
+		}
+	}
+	
+	// Keep plans stable for review
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Pike13ID != duplicates[j].Pike13ID {
+			return duplicates[i].Pike13ID < duplicates[j].Pike13ID
+		}
+		return duplicates[i].EventID < duplicates[j].EventID
+	})
+	return existing, duplicates
+}
+
+// canonicalEvent picks the event to keep among copies of one occurrence: the
+// one with the deterministic ID if present, otherwise the oldest
+func (s *SyncService) canonicalEvent(pike13ID string, group []*calendar.Event) *calendar.Event {
+	if len(group) == 1 {
+		return group[0]
+	}
+	
+	if want := calendar.EventIDFor(s.config, pike13ID); want != "" {
+		for _, event := range group {
+			if event.Id == want {
+				return event
+			}
+		}
+	}
+	
+	kept := group[0]
+	for _, event := range group[1:] {
+		if createdBefore(event, kept) {
+			kept = event
+		}
+	}
+	return kept
+}
+
+// createdBefore orders events by creation time, then by ID. Events without a
+// creation time sort last.
+func createdBefore(a, b *calendar.Event) bool {
+	ta, errA := time.Parse(time.RFC3339, a.Created)
+	tb, errB := time.Parse(time.RFC3339, b.Created)
+	switch {
+	case errA == nil && errB != nil:
+		return true
+	case errA != nil && errB == nil:
+		return false
+	case errA == nil && errB == nil && !ta.Equal(tb):
+		return ta.Before(tb)
+	}
+	return a.Id < b.Id
+}
+
+// planDuplicates records duplicates on the plan and, unless the policy is to
+// only report them, adds operations deleting them. Duplicates of frozen past
+// events are kept.
+func (s *SyncService) planDuplicates(plan *SyncPlan, duplicates []Duplicate) {
+	for i := range duplicates {
+		duplicate := &duplicates[i]
+		log.Printf("Duplicate of Pike13 event %s: %s keeps %s, extra copy %s",
+			duplicate.Pike13ID, duplicate.Summary, duplicate.KeptEventID, duplicate.EventID)
+		if s.config.DuplicatePolicy == DuplicatePolicyReport {
+			continue
+		}
+		
+		event := &calendar.Event{
+			Id:      duplicate.EventID,
+			Summary: duplicate.Summary,
+			Start:   &calendar.EventDateTime{DateTime: duplicate.Start},
+		}
+		if duplicate.End != "" {
+			event.End = &calendar.EventDateTime{DateTime: duplicate.End}
+		}
+		// Copies of past occurrences are part of the record as well
+		if s.frozen(event) {
+			log.Printf("Leaving duplicate of past event '%s' (Pike13 ID %s) in place", duplicate.Summary, duplicate.Pike13ID)
+			duplicate.Frozen = true
+			plan.Frozen++
+			continue
+		}
+		
+		plan.Operations = append(plan.Operations, Operation{
+			Kind:      OpDelete,
+			Pike13ID:  duplicate.Pike13ID,
+			EventID:   duplicate.EventID,
+			Summary:   duplicate.Summary,
+			Duplicate: true,
+			Event:     event,
+		})
+	}
+	plan.Duplicates = append(plan.Duplicates, duplicates...)
+}
+
+// duplicateDeletes counts the operations deleting duplicates
+func (p *SyncPlan) duplicateDeletes() int {
+	count := 0
+	for _, op := range p.Operations {
+		if op.Kind == OpDelete && op.Duplicate {
+			count++
+		}
+	}
+	return count
+}
+
+// frozenDuplicates counts the duplicates kept because they are frozen
+func (p *SyncPlan) frozenDuplicates() int {
+	count := 0
+	for _, duplicate := range p.Duplicates {
+		if duplicate.Frozen {
+			count++
+		}
+	}
+	return count
+}
+
+// PlanDedupe looks for duplicate synced events in any date range and plans
+// their cleanup without comparing against Pike13
+func (s *SyncService) PlanDedupe(fromDate, toDate string) (*SyncPlan, error) {
+	window, err := parseWindow(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dedupe window: %v", err)
+	}
+	
+	existingEvents, err := s.calendarService.GetExistingEvents(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving existing events: %v", err)
+	}
+	
+	plan := &SyncPlan{
+		CreatedAt:  s.clock.Now().UTC(),
+		CalendarID: s.config.CalendarID,
+		From:       fromDate,
+		To:         toDate,
+		Operations: []Operation{},
+	}
+	existing, duplicates := s.groupExisting(existingEvents, window)
+	plan.ExistingEvents = len(existing)
+	s.planDuplicates(plan, duplicates)
+	return plan, nil
+}
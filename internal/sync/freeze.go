@@ -0,0 +1,26 @@
+package sync
+
+import (
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+)
+
+// frozen reports whether an event is protected from changes because it ended
+// more than FreezeGrace ago. Events rebuilt from the state carry no end time,
+// so their start is used instead.
+func (s *SyncService) frozen(event *calendar.Event) bool {
+	if !s.config.FreezePastEvents {
+		return false
+	}
+	
+	end := endOf(event)
+	if end == "" {
+		end = startOf(event)
+	}
+	t, err := time.Parse(time.RFC3339, end)
+	if err != nil {
+		return false
+	}
+	return t.Before(s.clock.Now().Add(-s.config.FreezeGrace.Duration))
+}
@@ -0,0 +1,540 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+	"github.com/dcotelessa/pike13sync/internal/pike13"
+	"github.com/dcotelessa/pike13sync/internal/util"
+)
+
+// OperationKind is the type of change a plan makes to the calendar
+type OperationKind string
+
+const (
+	OpCreate OperationKind = "create"
+	OpUpdate OperationKind = "update"
+	OpDelete OperationKind = "delete"
+	OpCancel OperationKind = "cancel" // Sets the status of a removed event to cancelled
+	OpMark   OperationKind = "mark"   // Retitles a removed event instead of deleting it
+	OpAccept OperationKind = "accept" // Restamps an event edited in Google Calendar so the edit is kept
+)
+
+// FieldDiff describes one field that differs between the calendar and Pike13
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Operation is a single planned calendar change
+type Operation struct {
+	Kind        OperationKind   `json:"kind"`
+	Pike13ID    string          `json:"pike13_id"`
+	EventID     string          `json:"event_id,omitempty"` // Google event ID for updates and deletes
+	Summary     string          `json:"summary"`
+	Event       *calendar.Event `json:"event"`                  // Desired event, or the event to delete
+	Diffs       []FieldDiff     `json:"diffs,omitempty"`        // Field-level changes for updates
+	Hash        string          `json:"hash,omitempty"`         // Content hash of the desired event
+	Pike13State string          `json:"pike13_state,omitempty"` // Pike13 state of the occurrence
+	Duplicate   bool            `json:"duplicate,omitempty"`    // Deletes an extra copy of an event that is kept
+	Conflict    bool            `json:"conflict,omitempty"`     // Overwrites edits made in Google Calendar
+	Filtered    bool            `json:"filtered,omitempty"`     // Removes an event whose occurrence is filtered out
+}
+
+// KnownEvent is an event that is already in sync. It needs no change but is
+// recorded in the state store when the plan is applied.
+type KnownEvent struct {
+	Pike13ID    string `json:"pike13_id"`
+	EventID     string `json:"event_id"`
+	Summary     string `json:"summary"`
+	Start       string `json:"start"`
+	Hash        string `json:"hash"`
+	Pike13State string `json:"pike13_state,omitempty"`
+}
+
+// SyncPlan is the full set of changes needed to bring the calendar in line
+// with Pike13. It can be saved as JSON, reviewed, and applied later.
+type SyncPlan struct {
+	CreatedAt      time.Time    `json:"created_at"`
+	CalendarID     string       `json:"calendar_id"`
+	From           string       `json:"from"`
+	To             string       `json:"to"`
+	Pike13Events   int          `json:"pike13_events"`        // Pike13 occurrences inside the window
+	ExistingEvents int          `json:"existing_events"`      // Synced calendar events inside the window
+	FromState      bool         `json:"from_state,omitempty"` // Existing events came from the state store, not the calendar
+	Unchanged      int          `json:"unchanged"`
+	Frozen         int          `json:"frozen,omitempty"` // Past events left alone by freeze_past_events
+	Filtered       map[string]int `json:"filtered,omitempty"` // Pike13 events left out, by filter rule
+	Operations     []Operation  `json:"operations"`
+	Known          []KnownEvent `json:"known,omitempty"`    // Unchanged events, for the state store
+	Vanished       []string     `json:"vanished,omitempty"` // Previously synced Pike13 IDs no longer in Pike13
+	Duplicates     []Duplicate  `json:"duplicates,omitempty"` // Extra copies of synced events
+	Conflicts      []Conflict   `json:"conflicts,omitempty"`  // Synced events edited in Google Calendar
+}
+
+// Plan compares Pike13 events with the events already in the calendar and
+// returns the operations needed to sync them. Nothing is modified.
+// An existing event is updated when the content hash stored on it differs
+// from the hash of the Pike13 data, or always with ForceUpdate. Events edited
+// in Google Calendar since they were synced are handled by ConflictPolicy.
+// With FreezePastEvents, events that ended before FreezeGrace ago are never
+// updated or removed. Pike13 events dropped by the filter are not synced, and
+// their calendar events are removed by the removal policies and counted by
+// the deletion safeguards like any other removal. When a state store is set,
+// a failed calendar listing falls back to the events the state knows about.
+func (s *SyncService) Plan(pike13Events []pike13.Pike13Event, fromDate, toDate string) (*SyncPlan, error) {
+	window, err := parseWindow(fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sync window: %v", err)
+	}
+	
+	plan := &SyncPlan{
+		CreatedAt:  s.clock.Now().UTC(),
+		CalendarID: s.config.CalendarID,
+		From:       fromDate,
+		To:         toDate,
+		Operations: []Operation{},
+	}
+	
+	// Get existing events from Google Calendar for the same window Pike13 was fetched for
+	existingEvents, err := s.calendarService.GetExistingEvents(fromDate, toDate)
+	if err != nil {
+		if s.state == nil || len(s.state.Events) == 0 {
+			return nil, fmt.Errorf("error retrieving existing events: %v", err)
+		}
+		log.Printf("Warning: calendar listing failed (%v); planning from the %d events in the sync state", err, len(s.state.Events))
+		existingEvents = s.stateEvents()
+		plan.FromState = true
+	}
+	
+	// Create a map of existing events by Pike13 event ID, setting aside
+	// extra copies of the same occurrence
+	existingEventMap, duplicates := s.groupExisting(existingEvents, window)
+	plan.ExistingEvents = len(existingEventMap)
+	s.planDuplicates(plan, duplicates)
+	
+	// Process Pike13 events
+	seen := make(map[string]bool)
+	filtered := make(map[string]bool)
+	for _, pike13Event := range pike13Events {
+		if !window.containsTime(pike13Event.StartAt) {
+			log.Printf("Ignoring Pike13 event %d outside of sync window: %s", pike13Event.ID, pike13Event.StartAt)
+			continue
+		}
+		plan.Pike13Events++
+		
+		// Convert ID to string for lookup
+		pike13IDStr := strconv.Itoa(pike13Event.ID)
+		seen[pike13IDStr] = true
+		
+		// Leave out events the filter rules reject
+		if s.filter != nil {
+			if keep, rule := s.filter.Match(pike13Event); !keep {
+				log.Printf("Pike13 event %d (%s) filtered out by %q", pike13Event.ID, pike13Event.Name, rule)
+				if plan.Filtered == nil {
+					plan.Filtered = make(map[string]int)
+				}
+				plan.Filtered[rule]++
+				filtered[pike13IDStr] = true
+				continue
+			}
+		}
+		
+		// Format event data
+		eventData := s.calendarService.FormatEventData(pike13Event)
+		hash := calendar.StoredHash(eventData)
+		if hash == "" {
+			hash = calendar.ContentHash(eventData)
+		}
+		
+		// Check if event already exists
+		if existingEvent, exists := existingEventMap[pike13IDStr]; exists {
+			// Update only when the Pike13 content changed since it was written,
+			// or since an edit made in Google Calendar was accepted over it
+			existingHash := calendar.StoredHash(existingEvent)
+			pike13Hash := existingHash
+			accepted := calendar.AcceptedHash(existingEvent)
+			if accepted != "" {
+				pike13Hash = accepted
+			}
+			changed := pike13Hash != hash
+			// Adopted events without an instance tag are rewritten to carry ours
+			existingInstance := calendar.InstanceOf(existingEvent)
+			retag := existingInstance != s.config.InstanceID
+			// Events rebuilt from the state carry no content to compare. Pike13
+			// changes to an accepted edit conflict with it as well.
+			conflict := !plan.FromState && (calendar.IsEdited(existingEvent) || (accepted != "" && changed))
+			// An occurrence that was marked as removed is back in Pike13
+			if calendar.IsRemoved(existingEvent) {
+				eventData.ExtendedProperties.Private[calendar.PropertyRemoved] = "false"
+			}
+			if (changed || retag || conflict || s.config.ForceUpdate) && s.frozen(existingEvent) {
+				// Past events are a historical record; keep them as last written
+				log.Printf("Leaving past event '%s' (Pike13 ID %s) unchanged", existingEvent.Summary, pike13IDStr)
+				plan.Frozen++
+				plan.Known = append(plan.Known, KnownEvent{
+					Pike13ID:    pike13IDStr,
+					EventID:     existingEvent.Id,
+					Summary:     existingEvent.Summary,
+					Start:       startOf(existingEvent),
+					Hash:        existingHash,
+					Pike13State: pike13Event.State,
+				})
+				delete(existingEventMap, pike13IDStr)
+				continue
+			}
+			resolution := ""
+			if conflict {
+				resolution = s.resolveConflict(plan, pike13IDStr, existingEvent, changed)
+			}
+			if resolution == ResolutionKept {
+				plan.Operations = append(plan.Operations, planAccept(pike13IDStr, existingEvent, hash, pike13Event.State))
+				delete(existingEventMap, pike13IDStr)
+				continue
+			}
+			if resolution == ResolutionSkipped {
+				// The edit is left alone; remember the event as last written
+				plan.Unchanged++
+				plan.Known = append(plan.Known, KnownEvent{
+					Pike13ID:    pike13IDStr,
+					EventID:     existingEvent.Id,
+					Summary:     existingEvent.Summary,
+					Start:       startOf(existingEvent),
+					Hash:        existingHash,
+					Pike13State: pike13Event.State,
+				})
+				delete(existingEventMap, pike13IDStr)
+				continue
+			}
+			if changed || retag || conflict || s.config.ForceUpdate {
+				diffs := diffEvents(existingEvent, eventData)
+				if changed && len(diffs) == 0 {
+					// The change is in a field not shown in diffs, or the event predates content hashes
+					diffs = []FieldDiff{{Field: calendar.PropertyHash, Old: existingHash, New: hash}}
+				}
+				if retag {
+					diffs = append(diffs, FieldDiff{Field: calendar.PropertyInstance, Old: existingInstance, New: s.config.InstanceID})
+				}
+				plan.Operations = append(plan.Operations, Operation{
+					Kind:        OpUpdate,
+					Pike13ID:    pike13IDStr,
+					EventID:     existingEvent.Id,
+					Summary:     eventData.Summary,
+					Event:       eventData,
+					Diffs:       diffs,
+					Hash:        hash,
+					Pike13State: pike13Event.State,
+					Conflict:    conflict,
+				})
+			} else {
+				plan.Unchanged++
+				plan.Known = append(plan.Known, KnownEvent{
+					Pike13ID:    pike13IDStr,
+					EventID:     existingEvent.Id,
+					Summary:     eventData.Summary,
+					Start:       startOf(eventData),
+					Hash:        hash,
+					Pike13State: pike13Event.State,
+				})
+			}
+			// Remove from map to track what's been processed
+			delete(existingEventMap, pike13IDStr)
+		} else {
+			plan.Operations = append(plan.Operations, Operation{
+				Kind:        OpCreate,
+				Pike13ID:    pike13IDStr,
+				Summary:     eventData.Summary,
+				Event:       eventData,
+				Hash:        hash,
+				Pike13State: pike13Event.State,
+			})
+		}
+	}
+	
+	// Any events still in the map are filtered out or no longer in Pike13 and
+	// are removed, unless frozen or already marked as removed
+	var deletes []Operation
+	for pike13ID, eventToDelete := range existingEventMap {
+		if s.frozen(eventToDelete) {
+			log.Printf("Leaving past event '%s' (Pike13 ID %s) in place", eventToDelete.Summary, pike13ID)
+			plan.Frozen++
+			continue
+		}
+		if calendar.IsRemoved(eventToDelete) {
+			continue
+		}
+		// Events rebuilt from the state lack the description and color that
+		// marking is meant to keep, so they wait for a calendar listing
+		if plan.FromState && s.removalPolicy(eventToDelete) == RemovalPolicyMark {
+			log.Printf("Not marking '%s' (Pike13 ID %s) as removed until the calendar can be listed", eventToDelete.Summary, pike13ID)
+			continue
+		}
+		// Filtered out classes follow the removal policy like vanished ones
+		op := s.planRemoval(pike13ID, eventToDelete)
+		op.Filtered = filtered[pike13ID]
+		deletes = append(deletes, op)
+	}
+	// Map iteration order is random; keep plans stable for review
+	sort.Slice(deletes, func(i, j int) bool {
+		if a, b := startOf(deletes[i].Event), startOf(deletes[j].Event); a != b {
+			return a < b
+		}
+		return deletes[i].Pike13ID < deletes[j].Pike13ID
+	})
+	plan.Operations = append(plan.Operations, deletes...)
+	
+	// Report previously synced occurrences that Pike13 no longer returns
+	if s.state != nil {
+		for _, pike13ID := range s.state.IDs() {
+			entry, _ := s.state.Get(pike13ID)
+			if !seen[pike13ID] && window.containsTime(entry.Start) {
+				log.Printf("Pike13 event %s (%s) has vanished since it was last synced", pike13ID, entry.Summary)
+				plan.Vanished = append(plan.Vanished, pike13ID)
+			}
+		}
+	}
+	
+	return plan, nil
+}
+
+// stateEvents rebuilds the synced calendar events known to the state store,
+// for planning when the calendar cannot be listed
+func (s *SyncService) stateEvents() []*calendar.Event {
+	var events []*calendar.Event
+	for _, pike13ID := range s.state.IDs() {
+		entry, _ := s.state.Get(pike13ID)
+		event := &calendar.Event{
+			Id:      entry.EventID,
+			Summary: entry.Summary,
+			Start:   &calendar.EventDateTime{DateTime: entry.Start},
+			ExtendedProperties: &calendar.ExtendedProperties{
+				Private: map[string]string{
+					calendar.PropertyPike13ID: pike13ID,
+					calendar.PropertySynced:   "true",
+					calendar.PropertyHash:     entry.Hash,
+				},
+			},
+		}
+		// The state only ever holds events this deployment wrote
+		if s.config.InstanceID != "" {
+			event.ExtendedProperties.Private[calendar.PropertyInstance] = s.config.InstanceID
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// owns reports whether an event belongs to this deployment. Events without
+// an instance tag predate instance IDs and are adopted if configured to.
+func (s *SyncService) owns(event *calendar.Event) bool {
+	instance := calendar.InstanceOf(event)
+	if instance == s.config.InstanceID {
+		return true
+	}
+	return instance == "" && s.config.AdoptUntagged
+}
+
+// Count returns how many operations of the given kind the plan contains
+func (p *SyncPlan) Count(kind OperationKind) int {
+	count := 0
+	for _, op := range p.Operations {
+		if op.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// Stats returns the stats the plan would produce if every operation succeeded
+func (p *SyncPlan) Stats() SyncStats {
+	return SyncStats{
+		Created:   p.Count(OpCreate),
+		Updated:   p.Count(OpUpdate),
+		Deleted:   p.Count(OpDelete),
+		Cancelled: p.Count(OpCancel),
+		Marked:    p.Count(OpMark),
+		Skipped:   p.Unchanged + p.Count(OpAccept),
+		Frozen:    p.Frozen,
+		Filtered:  p.Filtered,
+		Conflicts: p.Conflicts,
+	}
+}
+
+// Describe writes a human-readable version of the plan
+func (p *SyncPlan) Describe(w io.Writer) {
+	fmt.Fprintf(w, "\n==== SYNC PLAN ====\n")
+	fmt.Fprintf(w, "Calendar: %s\n", p.CalendarID)
+	fmt.Fprintf(w, "Window: %s to %s\n", p.From, p.To)
+	if p.FromState {
+		fmt.Fprintf(w, "WARNING: the calendar could not be listed; existing events come from the sync state\n")
+	}
+	
+	for _, op := range p.Operations {
+		start, end := "", ""
+		if op.Event != nil {
+			start, end = startOf(op.Event), endOf(op.Event)
+		}
+		label := describeKind(op.Kind)
+		if op.Duplicate {
+			label += " DUPLICATE"
+		}
+		if op.Conflict {
+			label += " (overwrites calendar edits)"
+		}
+		if op.Filtered {
+			label += " (filtered out)"
+		}
+		fmt.Fprintf(w, "%s: %s (%s to %s) [Pike13 ID %s]\n",
+			label, op.Summary, util.FormatDateTime(start), util.FormatDateTime(end), op.Pike13ID)
+		for _, diff := range op.Diffs {
+			fmt.Fprintf(w, "    %s: %q -> %q\n", diff.Field, diff.Old, diff.New)
+		}
+	}
+	
+	frozenDuplicates := p.frozenDuplicates()
+	if reported := len(p.Duplicates) - p.duplicateDeletes() - frozenDuplicates; reported > 0 {
+		fmt.Fprintf(w, "%d duplicate event(s) found and left in place (duplicate_policy is report)\n", reported)
+	}
+	if frozenDuplicates > 0 {
+		fmt.Fprintf(w, "%d duplicate event(s) of past events left in place (freeze_past_events)\n", frozenDuplicates)
+	}
+	for _, conflict := range p.Conflicts {
+		if conflict.Resolution != ResolutionOverwritten {
+			fmt.Fprintf(w, "EDITED IN CALENDAR (%s): %s (%s) [Pike13 ID %s]\n",
+				conflict.Resolution, conflict.Summary, util.FormatDateTime(conflict.Start), conflict.Pike13ID)
+		}
+	}
+	if len(p.Filtered) > 0 {
+		fmt.Fprintf(w, "Filtered out of the sync: %s\n", DescribeFiltered(p.Filtered))
+	}
+	if len(p.Vanished) > 0 {
+		fmt.Fprintf(w, "Vanished from Pike13 since the last sync: %s\n", strings.Join(p.Vanished, ", "))
+	}
+	
+	fmt.Fprintf(w, "%d to create, %d to update, %d to delete, %d unchanged",
+		p.Count(OpCreate), p.Count(OpUpdate), p.Count(OpDelete), p.Unchanged)
+	if cancels, marks := p.Count(OpCancel), p.Count(OpMark); cancels+marks > 0 {
+		fmt.Fprintf(w, ", %d to cancel, %d to mark as removed", cancels, marks)
+	}
+	if accepts := p.Count(OpAccept); accepts > 0 {
+		fmt.Fprintf(w, ", %d calendar edit(s) to accept", accepts)
+	}
+	if p.Frozen > 0 {
+		fmt.Fprintf(w, ", %d past event(s) frozen", p.Frozen)
+	}
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "===================\n")
+}
+
+// DescribeFiltered lists how many events each filter rule left out, such as
+// "Private Training: 3, no include rule matched: 1", in rule name order
+func DescribeFiltered(filtered map[string]int) string {
+	rules := make([]string, 0, len(filtered))
+	for rule := range filtered {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		parts[i] = fmt.Sprintf("%s: %d", rule, filtered[rule])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeKind returns the label used for an operation in plan output
+func describeKind(kind OperationKind) string {
+	switch kind {
+	case OpCreate:
+		return "CREATE"
+	case OpUpdate:
+		return "UPDATE"
+	case OpDelete:
+		return "DELETE"
+	case OpCancel:
+		return "CANCEL"
+	case OpMark:
+		return "MARK REMOVED"
+	case OpAccept:
+		return "ACCEPT CALENDAR EDIT"
+	}
+	return string(kind)
+}
+
+// WritePlan saves a plan as indented JSON
+func WritePlan(path string, plan *SyncPlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding plan: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("error writing plan file: %v", err)
+	}
+	return nil
+}
+
+// ReadPlan loads a plan previously saved with WritePlan
+func ReadPlan(path string) (*SyncPlan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file: %v", err)
+	}
+	
+	var plan SyncPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan file: %v", err)
+	}
+	
+	// Refuse operations that could not be applied
+	for i, op := range plan.Operations {
+		if op.Event == nil {
+			return nil, fmt.Errorf("operation %d (%s) has no event", i+1, op.Kind)
+		}
+		if op.Kind != OpCreate && op.EventID == "" {
+			return nil, fmt.Errorf("operation %d (%s) has no event ID", i+1, op.Kind)
+		}
+	}
+	return &plan, nil
+}
+
+// diffEvents lists the managed fields that differ between two events
+func diffEvents(existing, desired *calendar.Event) []FieldDiff {
+	var diffs []FieldDiff
+	for _, change := range calendar.ManagedChanges(existing, desired) {
+		diffs = append(diffs, FieldDiff{Field: change.Field, Old: change.Old, New: change.New})
+	}
+	return diffs
+}
+
+// pike13IDOf returns the Pike13 occurrence ID stored on a calendar event
+func pike13IDOf(event *calendar.Event) string {
+	if event.ExtendedProperties == nil || event.ExtendedProperties.Private == nil {
+		return ""
+	}
+	return event.ExtendedProperties.Private[calendar.PropertyPike13ID]
+}
+
+// startOf returns the start date-time of an event, or "" if it has none
+func startOf(event *calendar.Event) string {
+	if event.Start == nil {
+		return ""
+	}
+	return event.Start.DateTime
+}
+
+// endOf returns the end date-time of an event, or "" if it has none
+func endOf(event *calendar.Event) string {
+	if event.End == nil {
+		return ""
+	}
+	return event.End.DateTime
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dcotelessa/pike13sync/internal/calendar"
+	"github.com/dcotelessa/pike13sync/internal/config"
+)
+
+// Removal policies, deciding what happens to a synced event whose Pike13
+// occurrence has disappeared. They are set separately for past and future
+// events.
+const (
+	RemovalPolicyDelete = "delete" // Delete the event (default)
+	RemovalPolicyCancel = "cancel" // Set its status to cancelled
+	RemovalPolicyMark   = "mark"   // Keep it, retitled with RemovedPrefix and grayed out
+)
+
+// RemovedPrefix is put in front of the title of events marked as removed
+const RemovedPrefix = "[REMOVED] "
+
+// checkRemovalPolicies reports removal policies that are not one of the
+// known ones. An unknown policy must not quietly delete events.
+func checkRemovalPolicies(cfg *config.Config) error {
+	for key, policy := range map[string]string{
+		"removal_policy_past":   cfg.RemovalPolicyPast,
+		"removal_policy_future": cfg.RemovalPolicyFuture,
+	} {
+		switch policy {
+		case RemovalPolicyDelete, RemovalPolicyCancel, RemovalPolicyMark:
+		default:
+			return fmt.Errorf("unknown %s %q (expected delete, cancel or mark)", key, policy)
+		}
+	}
+	return nil
+}
+
+// isRemoval reports whether an operation takes an event out of the schedule
+func isRemoval(kind OperationKind) bool {
+	return kind == OpDelete || kind == OpCancel || kind == OpMark
+}
+
+// removalPolicy returns the policy for an event, depending on whether it has
+// already started
+func (s *SyncService) removalPolicy(event *calendar.Event) string {
+	start, err := time.Parse(time.RFC3339, startOf(event))
+	if err == nil && start.Before(s.clock.Now()) {
+		return s.config.RemovalPolicyPast
+	}
+	return s.config.RemovalPolicyFuture
+}
+
+// planRemoval returns the operation that removes a synced event whose
+// Pike13 occurrence no longer exists or is filtered out
+func (s *SyncService) planRemoval(pike13ID string, event *calendar.Event) Operation {
+	op := Operation{
+		Kind:     OpDelete,
+		Pike13ID: pike13ID,
+		EventID:  event.Id,
+		Summary:  event.Summary,
+		Event:    event,
+	}
+	
+	switch s.removalPolicy(event) {
+	case RemovalPolicyCancel:
+		cancelled := *event
+		cancelled.Status = "cancelled"
+		op.Kind = OpCancel
+		op.Event = &cancelled
+		op.Diffs = []FieldDiff{{Field: "status", Old: event.Status, New: cancelled.Status}}
+	case RemovalPolicyMark:
+		marked := markRemoved(event)
+		op.Kind = OpMark
+		op.Event = marked
+		op.Hash = calendar.StoredHash(marked)
+		op.Diffs = diffEvents(event, marked)
+	}
+	return op
+}
+
+// markRemoved returns a copy of an event retitled and grayed out as removed.
+// The stored hash is updated so the marking does not count as an edit.
+func markRemoved(event *calendar.Event) *calendar.Event {
+	marked := *event
+	marked.Summary = RemovedPrefix + event.Summary
+	// Grayed out like cancelled classes
+	marked.ColorId = calendar.DefaultCancelledColor
+	
+	private := map[string]string{}
+	if event.ExtendedProperties != nil {
+		for key, value := range event.ExtendedProperties.Private {
+			private[key] = value
+		}
+	}
+	private[calendar.PropertyRemoved] = "true"
+	// Restored events get Pike13 data back, not an edit accepted earlier
+	private[calendar.PropertyAccepted] = ""
+	marked.ExtendedProperties = &calendar.ExtendedProperties{Private: private}
+	private[calendar.PropertyHash] = calendar.ContentHash(&marked)
+	return &marked
+}
@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dcotelessa/pike13sync/internal/config"
+)
+
+// ErrUnsafePlan is returned when a plan trips one of the deletion safeguards.
+// Runs can override it with --force after checking the plan is intended.
+var ErrUnsafePlan = errors.New("plan exceeds deletion safeguards")
+
+// CheckSafeguards verifies that a plan does not delete, cancel or mark as
+// removed suspiciously many events.
+// Pike13 occasionally answers with an empty but successful response (expired
+// credentials, API changes), which would otherwise wipe the calendar.
+func (p *SyncPlan) CheckSafeguards(cfg *config.Config) error {
+	if cfg.Force {
+		return nil
+	}
+	
+	// Cancelled and marked events drop out of the schedule just like deleted
+	// ones. Removing duplicates always leaves a copy of the event behind.
+	deletes := p.Count(OpDelete) + p.Count(OpCancel) + p.Count(OpMark) - p.duplicateDeletes()
+	if deletes == 0 {
+		return nil
+	}
+	
+	// An empty Pike13 window with synced events is more likely a bad response than a cleared schedule
+	if p.Pike13Events == 0 && !cfg.AllowEmptyPike13 {
+		return fmt.Errorf("%w: Pike13 returned no events but %d synced events would be removed", ErrUnsafePlan, deletes)
+	}
+	
+	if cfg.MaxDeletes > 0 && deletes > cfg.MaxDeletes {
+		return fmt.Errorf("%w: %d removals is more than max_deletes (%d)", ErrUnsafePlan, deletes, cfg.MaxDeletes)
+	}
+	
+	if cfg.MaxDeletePercent > 0 && p.ExistingEvents > 0 {
+		percent := float64(deletes) * 100 / float64(p.ExistingEvents)
+		if percent > cfg.MaxDeletePercent {
+			return fmt.Errorf("%w: removing %d of %d synced events (%.0f%%) is more than max_delete_percent (%.0f%%)",
+				ErrUnsafePlan, deletes, p.ExistingEvents, percent, cfg.MaxDeletePercent)
+		}
+	}
+	
+	return nil
+}
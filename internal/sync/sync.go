@@ -1,12 +1,16 @@
 package sync
 
 import (
-	"log"
-	"strconv"
+	"fmt"
+	stdsync "sync"
+	"time"
 
 	"github.com/dcotelessa/pike13sync/internal/calendar"
 	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/filter"
 	"github.com/dcotelessa/pike13sync/internal/pike13"
+	"github.com/dcotelessa/pike13sync/internal/state"
+	"github.com/dcotelessa/pike13sync/internal/util"
 )
 
 // SyncStats holds statistics about sync operations
@@ -15,21 +19,121 @@ type SyncStats struct {
 	Updated int
 	Deleted int
 	Skipped int
+	Failed  int
+	
+	// Removed events that were cancelled or marked instead of deleted
+	Cancelled int
+	Marked    int
+	
+	// Past events left alone because of FreezePastEvents
+	Frozen int
+	
+	// Pike13 events left out of the sync, by the name of the rule that filtered them
+	Filtered map[string]int
+	
+	// Outcomes holds the final result of every attempted calendar mutation
+	Outcomes []EventOutcome
+	
+	// Conflicts lists synced events that were edited in Google Calendar
+	Conflicts []Conflict
+}
+
+// EventOutcome records the final result of a calendar mutation for one event
+type EventOutcome struct {
+	Pike13ID string
+	Summary  string
+	Action   string          // "create", "update", "delete", "cancel", "mark" or "accept"
+	Result   calendar.Result // What the calendar reported
+	Err      error           // nil when the mutation succeeded, possibly after retries
+}
+
+// record counts the result of a mutation and adds its outcome to the stats
+func (s *SyncStats) record(pike13ID, summary, action string, result calendar.Result, err error) {
+	if err != nil {
+		result = calendar.ResultFailed
+	}
+	
+	switch result {
+	case calendar.ResultCreated:
+		s.Created++
+	case calendar.ResultUpdated:
+		// Cancelling and marking removed events are updates to the calendar
+		switch OperationKind(action) {
+		case OpCancel:
+			s.Cancelled++
+		case OpMark:
+			s.Marked++
+		case OpAccept:
+			// Accepting an edit leaves the event as it is
+			s.Skipped++
+		default:
+			s.Updated++
+		}
+	case calendar.ResultDeleted:
+		s.Deleted++
+	case calendar.ResultUnchanged:
+		// Nothing was written, so there is no outcome to report
+		s.Skipped++
+		return
+	case calendar.ResultFailed:
+		s.Failed++
+		if err == nil {
+			err = fmt.Errorf("%s reported failure", action)
+		}
+	}
+	
+	s.Outcomes = append(s.Outcomes, EventOutcome{
+		Pike13ID: pike13ID,
+		Summary:  summary,
+		Action:   action,
+		Result:   result,
+		Err:      err,
+	})
+}
+
+// failedDelete reports whether removing the given Pike13 event failed
+func (s SyncStats) failedDelete(pike13ID string) bool {
+	for _, outcome := range s.Outcomes {
+		if outcome.Pike13ID == pike13ID && isRemoval(OperationKind(outcome.Action)) && outcome.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns the outcomes of mutations that failed
+func (s SyncStats) Errors() []EventOutcome {
+	var failed []EventOutcome
+	for _, outcome := range s.Outcomes {
+		if outcome.Err != nil {
+			failed = append(failed, outcome)
+		}
+	}
+	return failed
 }
 
 // Define an interface for the calendar service so we can mock it in tests
 type CalendarServiceInterface interface {
-	GetExistingEvents() ([]*calendar.Event, error)
+	GetExistingEvents(timeMin, timeMax string) ([]*calendar.Event, error)
 	FormatEventData(pike13.Pike13Event) *calendar.Event
-	CreateEvent(*calendar.Event)
-	UpdateEvent(*calendar.Event, *calendar.Event) string
-	DeleteEvent(*calendar.Event)
+	CreateEvent(*calendar.Event) (calendar.Result, error)
+	UpdateEvent(eventID string, event *calendar.Event) (calendar.Result, error)
+	DeleteEvent(*calendar.Event) (calendar.Result, error)
+}
+
+// BatchCalendarService is implemented by calendar services that can send
+// several changes in one request. Apply uses it when CalendarBatchSize > 1.
+type BatchCalendarService interface {
+	ExecuteBatch([]calendar.BatchOp) []calendar.BatchResult
 }
 
 // SyncService handles synchronization between Pike13 and Google Calendar
 type SyncService struct {
 	calendarService CalendarServiceInterface
 	config          *config.Config
+	state           *state.State // Optional local record of synced events
+	filter          *filter.Filter // Optional rules deciding which Pike13 events are synced
+	clock           util.Clock
 }
 
 // NewSyncService creates a new sync service
@@ -37,63 +141,317 @@ func NewSyncService(calendarService CalendarServiceInterface, config *config.Con
 	return &SyncService{
 		calendarService: calendarService,
 		config:          config,
+		clock:           util.SystemClock{},
 	}
 }
 
-// SyncEvents synchronizes Pike13 events with Google Calendar
-func (s *SyncService) SyncEvents(pike13Events []pike13.Pike13Event) SyncStats {
-	stats := SyncStats{}
-	
-	// Get existing events from Google Calendar
-	existingEvents, err := s.calendarService.GetExistingEvents()
+// CheckPolicies reports configured policies that are not one of the known
+// values, so a typo stops the run instead of falling back to a default
+func CheckPolicies(cfg *config.Config) error {
+	for _, check := range []func(*config.Config) error{checkRemovalPolicies, checkConflictPolicy, checkDuplicatePolicy} {
+		if err := check(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetClock replaces the clock used to tell past from future events
+func (s *SyncService) SetClock(clock util.Clock) {
+	s.clock = clock
+}
+
+// SetFilter makes the service sync only the Pike13 events the filter keeps.
+// Calendar events of filtered out occurrences are removed according to the
+// removal policies.
+func (s *SyncService) SetFilter(f *filter.Filter) {
+	s.filter = f
+}
+
+// SetState makes the service plan against and record into a local state store
+func (s *SyncService) SetState(st *state.State) {
+	s.state = st
+}
+
+// SyncEvents synchronizes Pike13 events with Google Calendar by planning
+// the changes and applying them straight away.
+// Only events starting inside the fromDate/toDate window (RFC3339) are
+// created, updated or deleted; an empty bound leaves that side open.
+// An error is returned when the sync could not run at all or the plan trips
+// a deletion safeguard; failures of individual mutations are reported in the
+// stats instead.
+func (s *SyncService) SyncEvents(pike13Events []pike13.Pike13Event, fromDate, toDate string) (SyncStats, error) {
+	plan, err := s.Plan(pike13Events, fromDate, toDate)
 	if err != nil {
-		log.Printf("Error retrieving existing events: %v", err)
-		return stats
+		return SyncStats{}, err
 	}
+	return s.Apply(plan)
+}
+
+// opResult is what executing one planned operation returned
+type opResult struct {
+	result calendar.Result
+	err    error
+}
+
+// Apply executes the operations of a plan against Google Calendar.
+// Nothing is changed if the plan fails its deletion safeguards.
+// Operations run on up to CalendarConcurrency workers, limited to
+// CalendarQPS calls per second, and are grouped into batch requests of
+// CalendarBatchSize when the calendar service supports it. Results are
+// gathered in plan order, so the stats and outcomes do not depend on which
+// call finishes first.
+func (s *SyncService) Apply(plan *SyncPlan) (SyncStats, error) {
+	if err := plan.CheckSafeguards(s.config); err != nil {
+		return SyncStats{}, err
+	}
+	
+	results := s.execute(plan.Operations)
 	
-	// Create a map of existing events by Pike13 event ID
-	existingEventMap := make(map[string]*calendar.Event)
-	for _, event := range existingEvents {
-		// Check if this is a Pike13 event by looking for a custom property
-		if event.ExtendedProperties != nil && 
-		   event.ExtendedProperties.Private != nil && 
-		   event.ExtendedProperties.Private["pike13_id"] != "" {
-			pike13ID := event.ExtendedProperties.Private["pike13_id"]
-			existingEventMap[pike13ID] = event
+	stats := SyncStats{Skipped: plan.Unchanged, Frozen: plan.Frozen, Filtered: plan.Filtered, Conflicts: plan.Conflicts}
+	for i, op := range plan.Operations {
+		result, err := results[i].result, results[i].err
+		stats.record(op.Pike13ID, op.Summary, string(op.Kind), result, err)
+		if err == nil && result != calendar.ResultFailed {
+			s.recordState(op)
 		}
 	}
 	
-	// Process Pike13 events
-	for _, pike13Event := range pike13Events {
-		// Format event data
-		eventData := s.calendarService.FormatEventData(pike13Event)
-		
-		// Convert ID to string for lookup
-		pike13IDStr := strconv.Itoa(pike13Event.ID)
+	if s.state != nil {
+		now := s.clock.Now().UTC()
+		for _, known := range plan.Known {
+			s.state.Record(known.Pike13ID, state.Entry{
+				EventID:     known.EventID,
+				Hash:        known.Hash,
+				Pike13State: known.Pike13State,
+				Summary:     known.Summary,
+				Start:       known.Start,
+			}, now)
+		}
 		
-		// Check if event already exists
-		if existingEvent, exists := existingEventMap[pike13IDStr]; exists {
-			// Update existing event if needed
-			updateStatus := s.calendarService.UpdateEvent(existingEvent, eventData)
-			if updateStatus == "updated" {
-				stats.Updated++
-			} else if updateStatus == "unchanged" {
-				stats.Skipped++
+		// Forget vanished events unless their delete failed and must be retried
+		for _, pike13ID := range plan.Vanished {
+			if !stats.failedDelete(pike13ID) {
+				s.state.Remove(pike13ID)
+			}
+		}
+	}
+	
+	return stats, nil
+}
+
+// execute runs operations on a bounded pool of workers. Each result is
+// stored at the index of its operation.
+func (s *SyncService) execute(ops []Operation) []opResult {
+	results := make([]opResult, len(ops))
+	chunks := s.chunk(len(ops))
+	
+	workers := s.config.CalendarConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+	limiter := util.NewRateLimiter(s.config.CalendarQPS)
+	
+	jobs := make(chan []int)
+	var wg stdsync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for indexes := range jobs {
+				// Google counts every item of a batch against the quota
+				for range indexes {
+					limiter.Wait()
+				}
+				if len(indexes) == 1 {
+					results[indexes[0]] = s.executeOne(ops[indexes[0]])
+					continue
+				}
+				s.executeBatch(ops, indexes, results)
 			}
-			// Remove from map to track what's been processed
-			delete(existingEventMap, pike13IDStr)
-		} else {
-			// Create new event
-			s.calendarService.CreateEvent(eventData)
-			stats.Created++
+		}()
+	}
+	
+	for _, indexes := range chunks {
+		jobs <- indexes
+	}
+	close(jobs)
+	wg.Wait()
+	
+	return results
+}
+
+// chunk splits the indexes of n operations into groups sent together: one
+// per group without batch support, otherwise up to CalendarBatchSize
+func (s *SyncService) chunk(n int) [][]int {
+	size := 1
+	if _, ok := s.calendarService.(BatchCalendarService); ok && s.config.CalendarBatchSize > 1 {
+		size = s.config.CalendarBatchSize
+		if size > calendar.MaxBatchSize {
+			size = calendar.MaxBatchSize
+		}
+	}
+	
+	var chunks [][]int
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		indexes := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			indexes = append(indexes, i)
+		}
+		chunks = append(chunks, indexes)
+	}
+	return chunks
+}
+
+// executeBatch applies the operations at indexes in one batch request and
+// stores each item's result at the index of its operation
+func (s *SyncService) executeBatch(ops []Operation, indexes []int, results []opResult) {
+	batch := make([]calendar.BatchOp, 0, len(indexes))
+	for _, i := range indexes {
+		batch = append(batch, batchOp(ops[i]))
+	}
+	
+	batchResults := s.calendarService.(BatchCalendarService).ExecuteBatch(batch)
+	for j, i := range indexes {
+		if j >= len(batchResults) {
+			results[i] = opResult{err: fmt.Errorf("no batch result for %s of %q", ops[i].Kind, ops[i].Summary)}
+			continue
+		}
+		results[i] = opResult{result: batchResults[j].Result, err: batchResults[j].Err}
+	}
+}
+
+// batchOp converts a planned operation into a calendar batch item
+func batchOp(op Operation) calendar.BatchOp {
+	kinds := map[OperationKind]calendar.BatchKind{
+		OpCreate: calendar.BatchInsert,
+		OpUpdate: calendar.BatchUpdate,
+		OpDelete: calendar.BatchDelete,
+		OpCancel: calendar.BatchUpdate,
+		OpMark:   calendar.BatchUpdate,
+		OpAccept: calendar.BatchUpdate,
+	}
+	return calendar.BatchOp{Kind: kinds[op.Kind], EventID: op.EventID, Event: op.Event}
+}
+
+// executeOne performs a single operation against the calendar
+func (s *SyncService) executeOne(op Operation) opResult {
+	var res opResult
+	switch op.Kind {
+	case OpCreate:
+		res.result, res.err = s.calendarService.CreateEvent(op.Event)
+	case OpUpdate, OpCancel, OpMark, OpAccept:
+		res.result, res.err = s.calendarService.UpdateEvent(op.EventID, op.Event)
+	case OpDelete:
+		res.result, res.err = s.calendarService.DeleteEvent(op.Event)
+	default:
+		res.err = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	return res
+}
+
+// recordState updates the state store after a successful operation
+func (s *SyncService) recordState(op Operation) {
+	if s.state == nil {
+		return
+	}
+	
+	switch op.Kind {
+	case OpCreate, OpUpdate, OpAccept:
+		eventID := op.EventID
+		if eventID == "" {
+			// Creates learn their ID from the calendar
+			eventID = op.Event.Id
+		}
+		s.state.Record(op.Pike13ID, state.Entry{
+			EventID:     eventID,
+			Hash:        op.Hash,
+			Pike13State: op.Pike13State,
+			Summary:     op.Summary,
+			Start:       startOf(op.Event),
+		}, s.clock.Now().UTC())
+	case OpDelete, OpCancel, OpMark:
+		// The canonical copy of a duplicate is still synced
+		if !op.Duplicate {
+			s.state.Remove(op.Pike13ID)
 		}
 	}
+}
+
+// syncWindow is the time range a sync run is allowed to touch
+type syncWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// parseWindow parses RFC3339 window bounds; empty strings leave a bound open
+func parseWindow(fromDate, toDate string) (syncWindow, error) {
+	var window syncWindow
+	var err error
 	
-	// Any events still in the map need to be deleted (they're no longer in Pike13)
-	for _, eventToDelete := range existingEventMap {
-		s.calendarService.DeleteEvent(eventToDelete)
-		stats.Deleted++
+	if fromDate != "" {
+		window.start, err = time.Parse(time.RFC3339, fromDate)
+		if err != nil {
+			return window, fmt.Errorf("invalid window start %q: %v", fromDate, err)
+		}
+	}
+	if toDate != "" {
+		window.end, err = time.Parse(time.RFC3339, toDate)
+		if err != nil {
+			return window, fmt.Errorf("invalid window end %q: %v", toDate, err)
+		}
+	}
+	if !window.start.IsZero() && !window.end.IsZero() && !window.end.After(window.start) {
+		return window, fmt.Errorf("window end %s is not after start %s", toDate, fromDate)
 	}
 	
-	return stats
+	return window, nil
+}
+
+// unbounded reports whether the window places no restriction on events
+func (w syncWindow) unbounded() bool {
+	return w.start.IsZero() && w.end.IsZero()
+}
+
+// containsTime reports whether an RFC3339 start time falls inside the window.
+// Unparseable times are only accepted by an unbounded window.
+func (w syncWindow) containsTime(value string) bool {
+	if w.unbounded() {
+		return true
+	}
+	
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	if !w.start.IsZero() && t.Before(w.start) {
+		return false
+	}
+	if !w.end.IsZero() && !t.Before(w.end) {
+		return false
+	}
+	return true
+}
+
+// containsEvent reports whether a calendar event starts inside the window
+func (w syncWindow) containsEvent(event *calendar.Event) bool {
+	if w.unbounded() {
+		return true
+	}
+	if event.Start == nil {
+		return false
+	}
+	
+	// All-day events only carry a date
+	if event.Start.DateTime == "" && event.Start.Date != "" {
+		return w.containsTime(event.Start.Date + "T00:00:00Z")
+	}
+	return w.containsTime(event.Start.DateTime)
 }
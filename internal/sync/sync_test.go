@@ -1,39 +1,69 @@
 package sync_test
 
 import (
+	"bytes"
+	"errors"
+	"path/filepath"
 	"strconv"
+	"strings"
+	stdsync "sync"
 	"testing"
+	"time"
 	
 	"github.com/dcotelessa/pike13sync/internal/calendar"
 	"github.com/dcotelessa/pike13sync/internal/config"
+	"github.com/dcotelessa/pike13sync/internal/filter"
 	"github.com/dcotelessa/pike13sync/internal/pike13"
+	"github.com/dcotelessa/pike13sync/internal/state"
 	"github.com/dcotelessa/pike13sync/internal/sync"
+	"github.com/dcotelessa/pike13sync/internal/util"
 )
 
 // Ensure MockCalendarService implements the same interface as the calendar.Service
 // This interface must match the methods called by sync.SyncService
 type CalendarServiceInterface interface {
-	GetExistingEvents() ([]*calendar.Event, error)
+	GetExistingEvents(timeMin, timeMax string) ([]*calendar.Event, error)
 	FormatEventData(pike13.Pike13Event) *calendar.Event
-	CreateEvent(*calendar.Event)
-	UpdateEvent(*calendar.Event, *calendar.Event) string
-	DeleteEvent(*calendar.Event)
+	CreateEvent(*calendar.Event) (calendar.Result, error)
+	UpdateEvent(string, *calendar.Event) (calendar.Result, error)
+	DeleteEvent(*calendar.Event) (calendar.Result, error)
 }
 
-// MockCalendarService implements the calendar service interface for testing
+// MockCalendarService implements the calendar service interface for testing.
+// Mutations may be called from several workers at once.
 type MockCalendarService struct {
+	mu             stdsync.Mutex
 	existingEvents []*calendar.Event
 	createCalls    int
 	updateCalls    int
 	deleteCalls    int
 	skipCalls      int
+	touched        []string
+	timeMin        string
+	timeMax        string
+	failing        map[string]bool // Summaries whose mutations fail
+	listErr        error
+	delay          func(summary string) time.Duration // Optional latency per mutation
+}
+
+// mutation simulates the latency of a call, then locks the mock for recording it
+func (m *MockCalendarService) mutation(summary string) {
+	if m.delay != nil {
+		time.Sleep(m.delay(summary))
+	}
+	m.mu.Lock()
 }
 
 // Ensure the mock implements the interface
 var _ CalendarServiceInterface = (*MockCalendarService)(nil)
 
 // GetExistingEvents returns mock events
-func (m *MockCalendarService) GetExistingEvents() ([]*calendar.Event, error) {
+func (m *MockCalendarService) GetExistingEvents(timeMin, timeMax string) ([]*calendar.Event, error) {
+	m.timeMin = timeMin
+	m.timeMax = timeMax
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
 	return m.existingEvents, nil
 }
 
@@ -43,8 +73,9 @@ func (m *MockCalendarService) FormatEventData(event pike13.Pike13Event) *calenda
 	// Convert ID to string properly
 	idStr := strconv.Itoa(event.ID)
 	
-	return &calendar.Event{
+	formatted := &calendar.Event{
 		Summary: event.Name,
+		Start:   &calendar.EventDateTime{DateTime: event.StartAt},
 		ExtendedProperties: &calendar.ExtendedProperties{
 			Private: map[string]string{
 				"pike13_id":   idStr,
@@ -52,26 +83,45 @@ func (m *MockCalendarService) FormatEventData(event pike13.Pike13Event) *calenda
 			},
 		},
 	}
+	formatted.ExtendedProperties.Private[calendar.PropertyHash] = calendar.ContentHash(formatted)
+	return formatted
 }
 
 // CreateEvent mocks event creation
-func (m *MockCalendarService) CreateEvent(event *calendar.Event) {
+func (m *MockCalendarService) CreateEvent(event *calendar.Event) (calendar.Result, error) {
+	m.mutation(event.Summary)
+	defer m.mu.Unlock()
+	m.touched = append(m.touched, event.Summary)
 	m.createCalls++
+	if m.failing[event.Summary] {
+		return calendar.ResultFailed, errors.New("create failed")
+	}
+	event.Id = "created" + strconv.Itoa(m.createCalls)
+	return calendar.ResultCreated, nil
 }
 
 // UpdateEvent mocks event updates
-func (m *MockCalendarService) UpdateEvent(existing *calendar.Event, new *calendar.Event) string {
-	if existing.Summary == new.Summary {
-		m.skipCalls++
-		return "unchanged"
-	}
+func (m *MockCalendarService) UpdateEvent(eventID string, event *calendar.Event) (calendar.Result, error) {
+	m.mutation(event.Summary)
+	defer m.mu.Unlock()
+	m.touched = append(m.touched, event.Summary)
 	m.updateCalls++
-	return "updated"
+	if m.failing[event.Summary] {
+		return calendar.ResultFailed, errors.New("update failed")
+	}
+	return calendar.ResultUpdated, nil
 }
 
 // DeleteEvent mocks event deletion
-func (m *MockCalendarService) DeleteEvent(event *calendar.Event) {
+func (m *MockCalendarService) DeleteEvent(event *calendar.Event) (calendar.Result, error) {
+	m.mutation(event.Summary)
+	defer m.mu.Unlock()
+	m.touched = append(m.touched, event.Summary)
 	m.deleteCalls++
+	if m.failing[event.Summary] {
+		return calendar.ResultFailed, errors.New("delete failed")
+	}
+	return calendar.ResultDeleted, nil
 }
 
 // TestSyncEvents tests the SyncEvents function
@@ -103,8 +153,8 @@ func TestSyncEvents(t *testing.T) {
 		existingEvents: mockEvents,
 	}
 	
-	// Create config
-	cfg := &config.Config{}
+	// Create config; these cases are about the operations, not the safeguards
+	cfg := &config.Config{AllowEmptyPike13: true}
 	
 	// Create sync service with mock calendar
 	syncService := sync.NewSyncService(mockCalendar, cfg)
@@ -201,7 +251,10 @@ func TestSyncEvents(t *testing.T) {
 			}
 			
 			// Run sync
-			stats := syncService.SyncEvents(tc.pike13Events)
+			stats, err := syncService.SyncEvents(tc.pike13Events, "", "")
+			if err != nil {
+				t.Fatalf("SyncEvents returned error: %v", err)
+			}
 			
 			// Verify expected stats
 			if stats.Created != tc.expectedStats.Created {
@@ -233,3 +286,1201 @@ func TestSyncEvents(t *testing.T) {
 		})
 	}
 }
+
+// syncedEvent builds a calendar event carrying the Pike13 sync properties
+func syncedEvent(pike13ID, summary, start string) *calendar.Event {
+	return &calendar.Event{
+		Summary: summary,
+		Start:   &calendar.EventDateTime{DateTime: start},
+		ExtendedProperties: &calendar.ExtendedProperties{
+			Private: map[string]string{
+				"pike13_id":   pike13ID,
+				"pike13_sync": "true",
+			},
+		},
+	}
+}
+
+// TestSyncEventsWindow verifies that events outside the sync window are never touched
+func TestSyncEventsWindow(t *testing.T) {
+	fromDate := "2025-05-11T00:00:00Z"
+	toDate := "2025-05-18T00:00:00Z"
+	
+	mockCalendar := &MockCalendarService{
+		existingEvents: []*calendar.Event{
+			syncedEvent("1", "Last Week Class", "2025-05-04T17:00:00Z"),
+			syncedEvent("2", "This Week Class", "2025-05-14T17:00:00Z"),
+			syncedEvent("3", "Removed Class", "2025-05-15T17:00:00Z"),
+			syncedEvent("4", "Next Week Class", "2025-05-18T17:00:00Z"),
+			syncedEvent("5", "Window End Class", "2025-05-18T00:00:00Z"),
+		},
+	}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{})
+	
+	pike13Events := []pike13.Pike13Event{
+		{ID: 2, Name: "This Week Class (renamed)", StartAt: "2025-05-14T17:00:00Z"},
+		{ID: 6, Name: "New Class", StartAt: "2025-05-16T17:00:00Z"},
+		{ID: 7, Name: "Outside Class", StartAt: "2025-05-25T17:00:00Z"},
+	}
+	
+	stats, err := syncService.SyncEvents(pike13Events, fromDate, toDate)
+	if err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	
+	// The calendar must be queried with the same window Pike13 was fetched for
+	if mockCalendar.timeMin != fromDate || mockCalendar.timeMax != toDate {
+		t.Errorf("Expected calendar window %s - %s, got %s - %s",
+			fromDate, toDate, mockCalendar.timeMin, mockCalendar.timeMax)
+	}
+	
+	if stats.Created != 1 || stats.Updated != 1 || stats.Deleted != 1 {
+		t.Errorf("Expected 1 create, 1 update, 1 delete, got %+v", stats)
+	}
+	
+	for _, summary := range mockCalendar.touched {
+		switch summary {
+		case "Last Week Class", "Next Week Class", "Window End Class", "Outside Class":
+			t.Errorf("Event outside the sync window was touched: %s", summary)
+		}
+	}
+}
+
+// TestSyncEventsOutcomes verifies that failed mutations are reported per event and not counted as done
+func TestSyncEventsOutcomes(t *testing.T) {
+	mockCalendar := &MockCalendarService{
+		existingEvents: []*calendar.Event{
+			syncedEvent("1", "Old Name", "2025-05-12T17:00:00Z"),
+			syncedEvent("2", "Gone Class", "2025-05-13T17:00:00Z"),
+		},
+		failing: map[string]bool{
+			"New Name":   true,
+			"Gone Class": true,
+		},
+	}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{})
+	
+	stats, err := syncService.SyncEvents([]pike13.Pike13Event{
+		{ID: 1, Name: "New Name", StartAt: "2025-05-12T17:00:00Z"},
+		{ID: 3, Name: "Fresh Class", StartAt: "2025-05-14T17:00:00Z"},
+	}, "", "")
+	if err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	
+	if stats.Created != 1 || stats.Updated != 0 || stats.Deleted != 0 || stats.Failed != 2 {
+		t.Errorf("Expected 1 create and 2 failures, got %+v", stats)
+	}
+	if failed := stats.Errors(); len(failed) != 2 {
+		t.Errorf("Expected 2 errors, got %d", len(failed))
+	}
+	
+	outcomes := make(map[string]sync.EventOutcome)
+	for _, outcome := range stats.Outcomes {
+		outcomes[outcome.Pike13ID] = outcome
+	}
+	if len(outcomes) != 3 {
+		t.Fatalf("Expected 3 outcomes, got %d", len(stats.Outcomes))
+	}
+	if outcome := outcomes["1"]; outcome.Action != "update" || outcome.Result != calendar.ResultFailed || outcome.Err == nil {
+		t.Errorf("Expected failed update for event 1, got %+v", outcome)
+	}
+	if outcome := outcomes["2"]; outcome.Action != "delete" || outcome.Err == nil {
+		t.Errorf("Expected failed delete for event 2, got %+v", outcome)
+	}
+	if outcome := outcomes["3"]; outcome.Action != "create" || outcome.Result != calendar.ResultCreated || outcome.Err != nil {
+		t.Errorf("Expected successful create for event 3, got %+v", outcome)
+	}
+}
+
+// TestSyncEventsListingError verifies that a failed calendar listing fails the sync instead of reporting zero changes
+func TestSyncEventsListingError(t *testing.T) {
+	mockCalendar := &MockCalendarService{listErr: errors.New("listing failed")}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{})
+	
+	_, err := syncService.SyncEvents([]pike13.Pike13Event{{ID: 1, Name: "Class"}}, "", "")
+	if err == nil {
+		t.Fatal("Expected error when the calendar listing fails, got nil")
+	}
+	if mockCalendar.createCalls != 0 {
+		t.Errorf("Expected no creates after a listing failure, got %d", mockCalendar.createCalls)
+	}
+}
+
+// writtenEvent returns the calendar event a previous sync would have written for a Pike13 event
+func writtenEvent(m *MockCalendarService, event pike13.Pike13Event, eventID string) *calendar.Event {
+	written := m.FormatEventData(event)
+	written.Id = eventID
+	return written
+}
+
+// TestPlan verifies that planning produces field-level diffs without touching the calendar
+func TestPlan(t *testing.T) {
+	unchanged := writtenEvent(&MockCalendarService{}, pike13.Pike13Event{ID: 1, Name: "Same Class", StartAt: "2025-05-12T17:00:00Z"}, "evt1")
+	renamed := syncedEvent("2", "Old Name", "2025-05-13T17:00:00Z")
+	renamed.Id = "evt2"
+	removed := syncedEvent("3", "Gone Class", "2025-05-14T17:00:00Z")
+	removed.Id = "evt3"
+	
+	mockCalendar := &MockCalendarService{
+		existingEvents: []*calendar.Event{unchanged, renamed, removed},
+	}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{CalendarID: "cal@example.com"})
+	
+	plan, err := syncService.Plan([]pike13.Pike13Event{
+		{ID: 1, Name: "Same Class", StartAt: "2025-05-12T17:00:00Z"},
+		{ID: 2, Name: "New Name", StartAt: "2025-05-13T17:00:00Z"},
+		{ID: 4, Name: "Fresh Class", StartAt: "2025-05-15T17:00:00Z"},
+	}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	
+	if len(mockCalendar.touched) != 0 {
+		t.Errorf("Planning must not modify the calendar, touched %v", mockCalendar.touched)
+	}
+	if plan.CalendarID != "cal@example.com" || plan.Unchanged != 1 {
+		t.Errorf("Unexpected plan header: %+v", plan)
+	}
+	if len(plan.Operations) != 3 {
+		t.Fatalf("Expected 3 operations, got %d", len(plan.Operations))
+	}
+	
+	update := plan.Operations[0]
+	if update.Kind != sync.OpUpdate || update.EventID != "evt2" || update.Pike13ID != "2" {
+		t.Errorf("Expected update of evt2 first, got %+v", update)
+	}
+	if len(update.Diffs) != 1 || update.Diffs[0] != (sync.FieldDiff{Field: "summary", Old: "Old Name", New: "New Name"}) {
+		t.Errorf("Expected a single summary diff, got %+v", update.Diffs)
+	}
+	if create := plan.Operations[1]; create.Kind != sync.OpCreate || create.Pike13ID != "4" {
+		t.Errorf("Expected create of Pike13 event 4, got %+v", create)
+	}
+	if del := plan.Operations[2]; del.Kind != sync.OpDelete || del.EventID != "evt3" {
+		t.Errorf("Expected delete of evt3, got %+v", del)
+	}
+	
+	var out bytes.Buffer
+	plan.Describe(&out)
+	for _, want := range []string{"UPDATE: New Name", "summary: \"Old Name\" -> \"New Name\"", "CREATE: Fresh Class", "DELETE: Gone Class"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected plan description to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+// TestPlanRoundTrip verifies that a saved plan can be read back and applied
+func TestPlanRoundTrip(t *testing.T) {
+	existing := syncedEvent("2", "Old Name", "2025-05-13T17:00:00Z")
+	existing.Id = "evt2"
+	planner := sync.NewSyncService(&MockCalendarService{
+		existingEvents: []*calendar.Event{existing},
+	}, &config.Config{CalendarID: "cal@example.com"})
+	
+	plan, err := planner.Plan([]pike13.Pike13Event{
+		{ID: 2, Name: "New Name", StartAt: "2025-05-13T17:00:00Z"},
+		{ID: 4, Name: "Fresh Class", StartAt: "2025-05-15T17:00:00Z"},
+	}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := sync.WritePlan(path, plan); err != nil {
+		t.Fatalf("WritePlan returned error: %v", err)
+	}
+	loaded, err := sync.ReadPlan(path)
+	if err != nil {
+		t.Fatalf("ReadPlan returned error: %v", err)
+	}
+	if loaded.CalendarID != plan.CalendarID || len(loaded.Operations) != len(plan.Operations) {
+		t.Fatalf("Loaded plan does not match: %+v", loaded)
+	}
+	if loaded.Operations[0].EventID != "evt2" || loaded.Operations[0].Event.Summary != "New Name" {
+		t.Errorf("Update operation lost in round trip: %+v", loaded.Operations[0])
+	}
+	
+	// Applying the loaded plan must not list the calendar again
+	applier := &MockCalendarService{listErr: errors.New("listing should not be needed")}
+	stats, err := sync.NewSyncService(applier, &config.Config{}).Apply(loaded)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Created != 1 || stats.Updated != 1 || stats.Failed != 0 {
+		t.Errorf("Expected 1 create and 1 update, got %+v", stats)
+	}
+	if applier.timeMin != "" || applier.timeMax != "" {
+		t.Error("Apply queried the calendar")
+	}
+}
+
+// TestReadPlanInvalid verifies that plans with unusable operations are rejected
+func TestReadPlanInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.json")
+	plan := &sync.SyncPlan{Operations: []sync.Operation{
+		{Kind: sync.OpDelete, Pike13ID: "1", Event: &calendar.Event{Summary: "No ID"}},
+	}}
+	if err := sync.WritePlan(path, plan); err != nil {
+		t.Fatalf("WritePlan returned error: %v", err)
+	}
+	if _, err := sync.ReadPlan(path); err == nil {
+		t.Error("Expected error for a delete without an event ID, got nil")
+	}
+}
+
+// TestSyncEventsSafeguards verifies that suspicious mass deletions are refused unless forced
+func TestSyncEventsSafeguards(t *testing.T) {
+	existing := func() []*calendar.Event {
+		var events []*calendar.Event
+		for i := 1; i <= 10; i++ {
+			events = append(events, syncedEvent(strconv.Itoa(i), "Class "+strconv.Itoa(i), "2025-05-12T17:00:00Z"))
+		}
+		return events
+	}
+	// Pike13 still knows about the first n classes
+	remaining := func(n int) []pike13.Pike13Event {
+		var events []pike13.Pike13Event
+		for i := 1; i <= n; i++ {
+			events = append(events, pike13.Pike13Event{ID: i, Name: "Class " + strconv.Itoa(i), StartAt: "2025-05-12T17:00:00Z"})
+		}
+		return events
+	}
+	
+	testCases := []struct {
+		name        string
+		cfg         config.Config
+		pike13      []pike13.Pike13Event
+		expectError bool
+	}{
+		{
+			name:        "Empty Pike13 response is refused",
+			cfg:         config.Config{},
+			pike13:      nil,
+			expectError: true,
+		},
+		{
+			name:   "Empty Pike13 response allowed by config",
+			cfg:    config.Config{AllowEmptyPike13: true},
+			pike13: nil,
+		},
+		{
+			name:        "Too many deletes",
+			cfg:         config.Config{MaxDeletes: 3},
+			pike13:      remaining(6),
+			expectError: true,
+		},
+		{
+			name:   "Deletes within the limit",
+			cfg:    config.Config{MaxDeletes: 4},
+			pike13: remaining(6),
+		},
+		{
+			name:        "Too large a share of the calendar",
+			cfg:         config.Config{MaxDeletePercent: 50},
+			pike13:      remaining(4),
+			expectError: true,
+		},
+		{
+			name:   "Share within the limit",
+			cfg:    config.Config{MaxDeletePercent: 50},
+			pike13: remaining(5),
+		},
+		{
+			name:        "Marking removed events counts against the safeguards",
+			cfg:         config.Config{MaxDeletes: 1, MaxDeletePercent: 10, RemovalPolicyFuture: sync.RemovalPolicyMark, RemovalPolicyPast: sync.RemovalPolicyMark},
+			pike13:      nil,
+			expectError: true,
+		},
+		{
+			name:        "Too many events marked as removed",
+			cfg:         config.Config{MaxDeletes: 3, AllowEmptyPike13: true, RemovalPolicyFuture: sync.RemovalPolicyMark, RemovalPolicyPast: sync.RemovalPolicyMark},
+			pike13:      remaining(6),
+			expectError: true,
+		},
+		{
+			name:        "Too large a share marked as removed",
+			cfg:         config.Config{MaxDeletePercent: 50, RemovalPolicyFuture: sync.RemovalPolicyMark, RemovalPolicyPast: sync.RemovalPolicyMark},
+			pike13:      remaining(4),
+			expectError: true,
+		},
+		{
+			name:   "Force overrides every safeguard",
+			cfg:    config.Config{MaxDeletes: 1, MaxDeletePercent: 10, Force: true},
+			pike13: nil,
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCalendar := &MockCalendarService{existingEvents: existing()}
+			cfg := tc.cfg
+			syncService := sync.NewSyncService(mockCalendar, &cfg)
+			
+			_, err := syncService.SyncEvents(tc.pike13, "", "")
+			if tc.expectError {
+				if !errors.Is(err, sync.ErrUnsafePlan) {
+					t.Fatalf("Expected ErrUnsafePlan, got %v", err)
+				}
+				if mockCalendar.deleteCalls != 0 || mockCalendar.createCalls != 0 || mockCalendar.updateCalls != 0 {
+					t.Errorf("Expected no calendar changes after a refused plan, got %d deletes", mockCalendar.deleteCalls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SyncEvents returned error: %v", err)
+			}
+			if want := 10 - len(tc.pike13); mockCalendar.deleteCalls != want {
+				t.Errorf("Expected %d deletes, got %d", want, mockCalendar.deleteCalls)
+			}
+		})
+	}
+}
+
+// TestSyncEventsState verifies that the state store records synced events, skips
+// unchanged ones, notices vanished ones and stands in for a failed listing
+func TestSyncEventsState(t *testing.T) {
+	st := state.New(filepath.Join(t.TempDir(), "state.json"))
+	mockCalendar := &MockCalendarService{}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{AllowEmptyPike13: true})
+	syncService.SetState(st)
+	
+	pike13Events := []pike13.Pike13Event{
+		{ID: 1, Name: "Morning Class", StartAt: "2025-05-12T17:00:00Z", State: "active"},
+		{ID: 2, Name: "Evening Class", StartAt: "2025-05-13T17:00:00Z", State: "active"},
+	}
+	
+	// First run creates both events and records their calendar IDs
+	if _, err := syncService.SyncEvents(pike13Events, "", ""); err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	if len(st.Events) != 2 {
+		t.Fatalf("Expected 2 state entries, got %d", len(st.Events))
+	}
+	entry, _ := st.Get("1")
+	if entry.EventID == "" || entry.Hash == "" || entry.Pike13State != "active" || entry.LastSynced.IsZero() {
+		t.Errorf("Incomplete state entry: %+v", entry)
+	}
+	
+	// The calendar now holds the events, but with a summary edited by hand.
+	// The Pike13 content is unchanged since the last sync, so nothing is updated.
+	first, _ := st.Get("1")
+	second, _ := st.Get("2")
+	edited := writtenEvent(mockCalendar, pike13Events[0], first.EventID)
+	edited.Summary = "Edited by hand"
+	kept := writtenEvent(mockCalendar, pike13Events[1], second.EventID)
+	mockCalendar.existingEvents = []*calendar.Event{edited, kept}
+	mockCalendar.updateCalls = 0
+	
+	stats, err := syncService.SyncEvents(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	if stats.Updated != 0 || stats.Skipped != 2 {
+		t.Errorf("Expected 2 unchanged events, got %+v", stats)
+	}
+	
+	// Event 2 vanishes from Pike13 while the calendar cannot be listed; the
+	// state stands in for the listing so it is still deleted
+	mockCalendar.listErr = errors.New("listing unavailable")
+	plan, err := syncService.Plan(pike13Events[:1], "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error with a state to fall back on: %v", err)
+	}
+	if !plan.FromState {
+		t.Error("Expected the plan to be marked as built from state")
+	}
+	if len(plan.Vanished) != 1 || plan.Vanished[0] != "2" {
+		t.Errorf("Expected event 2 to be reported as vanished, got %v", plan.Vanished)
+	}
+	if plan.Count(sync.OpDelete) != 1 || plan.Operations[0].EventID != second.EventID {
+		t.Fatalf("Expected a delete of %s, got %+v", second.EventID, plan.Operations)
+	}
+	
+	if _, err := syncService.Apply(plan); err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if _, ok := st.Get("2"); ok {
+		t.Error("Expected the vanished event to be removed from the state")
+	}
+	if _, ok := st.Get("1"); !ok {
+		t.Error("Expected the remaining event to stay in the state")
+	}
+}
+
+// TestPlanContentHash verifies that updates are decided by the stored content hash
+func TestPlanContentHash(t *testing.T) {
+	mockCalendar := &MockCalendarService{}
+	class := pike13.Pike13Event{ID: 1, Name: "Class", StartAt: "2025-05-12T17:00:00Z"}
+	
+	// Google hands back times in the calendar's zone; the same instant is not a change
+	normalized := writtenEvent(mockCalendar, class, "evt1")
+	normalized.Start.DateTime = "2025-05-12T10:00:00-07:00"
+	
+	// Events written before hashes were stored are rewritten once to record one
+	legacy := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 2, Name: "Legacy", StartAt: "2025-05-13T17:00:00Z"}, "evt2")
+	delete(legacy.ExtendedProperties.Private, calendar.PropertyHash)
+	
+	mockCalendar.existingEvents = []*calendar.Event{normalized, legacy}
+	pike13Events := []pike13.Pike13Event{class, {ID: 2, Name: "Legacy", StartAt: "2025-05-13T17:00:00Z"}}
+	
+	plan, err := sync.NewSyncService(mockCalendar, &config.Config{}).Plan(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if plan.Unchanged != 1 || len(plan.Operations) != 1 {
+		t.Fatalf("Expected 1 unchanged event and 1 update, got %+v", plan)
+	}
+	update := plan.Operations[0]
+	if update.Pike13ID != "2" || len(update.Diffs) != 1 || update.Diffs[0].Field != calendar.PropertyHash {
+		t.Errorf("Expected a hash-only update of the legacy event, got %+v", update)
+	}
+	
+	// --force-update rewrites everything
+	plan, err = sync.NewSyncService(mockCalendar, &config.Config{ForceUpdate: true}).Plan(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if plan.Count(sync.OpUpdate) != 2 || plan.Unchanged != 0 {
+		t.Errorf("Expected 2 forced updates, got %d updates and %d unchanged", plan.Count(sync.OpUpdate), plan.Unchanged)
+	}
+}
+
+// TestPlanDuplicates verifies that extra copies of an occurrence are detected and the canonical one kept
+func TestPlanDuplicates(t *testing.T) {
+	class := pike13.Pike13Event{ID: 7, Name: "Class", StartAt: "2025-05-12T17:00:00Z"}
+	deterministic := calendar.EventID("pike13sync", "7")
+	
+	newer := writtenEvent(&MockCalendarService{}, class, "random2")
+	newer.Created = "2025-05-02T00:00:00Z"
+	older := writtenEvent(&MockCalendarService{}, class, "random1")
+	older.Created = "2025-05-01T00:00:00Z"
+	canonical := writtenEvent(&MockCalendarService{}, class, deterministic)
+	canonical.Created = "2025-05-03T00:00:00Z"
+	
+	testCases := []struct {
+		name     string
+		existing []*calendar.Event
+		policy   string
+		kept     string
+		deletes  []string
+	}{
+		{
+			name:     "Deterministic ID wins",
+			existing: []*calendar.Event{newer, canonical, older},
+			kept:     deterministic,
+			deletes:  []string{"random1", "random2"},
+		},
+		{
+			name:     "Oldest wins without a deterministic ID",
+			existing: []*calendar.Event{newer, older},
+			kept:     "random1",
+			deletes:  []string{"random2"},
+		},
+		{
+			name:     "Report only",
+			existing: []*calendar.Event{newer, older},
+			policy:   sync.DuplicatePolicyReport,
+			kept:     "random1",
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCalendar := &MockCalendarService{existingEvents: tc.existing}
+			cfg := &config.Config{EventIDNamespace: "pike13sync", DuplicatePolicy: tc.policy}
+			syncService := sync.NewSyncService(mockCalendar, cfg)
+			
+			plan, err := syncService.Plan([]pike13.Pike13Event{class}, "", "")
+			if err != nil {
+				t.Fatalf("Plan returned error: %v", err)
+			}
+			
+			if len(plan.Duplicates) != len(tc.existing)-1 {
+				t.Errorf("Expected %d duplicates, got %d", len(tc.existing)-1, len(plan.Duplicates))
+			}
+			for _, duplicate := range plan.Duplicates {
+				if duplicate.KeptEventID != tc.kept {
+					t.Errorf("Expected %s to be kept, got %s", tc.kept, duplicate.KeptEventID)
+				}
+			}
+			
+			var deleted []string
+			for _, op := range plan.Operations {
+				if op.Kind != sync.OpDelete {
+					t.Errorf("Expected only duplicate deletes, got %s of %s", op.Kind, op.EventID)
+					continue
+				}
+				if !op.Duplicate {
+					t.Errorf("Expected delete of %s to be marked as a duplicate", op.EventID)
+				}
+				deleted = append(deleted, op.EventID)
+			}
+			if strings.Join(deleted, ",") != strings.Join(tc.deletes, ",") {
+				t.Errorf("Expected deletes %v, got %v", tc.deletes, deleted)
+			}
+			
+			// Removing duplicates is never blocked by the deletion safeguards
+			if err := plan.CheckSafeguards(&config.Config{MaxDeletes: 1, MaxDeletePercent: 1}); err != nil {
+				t.Errorf("Expected duplicate deletes to pass the safeguards, got %v", err)
+			}
+		})
+	}
+}
+
+// TestPlanDedupe verifies the standalone duplicate scan
+func TestPlanDedupe(t *testing.T) {
+	first := syncedEvent("1", "Class", "2025-03-03T17:00:00Z")
+	first.Id = "a"
+	second := syncedEvent("1", "Class", "2025-03-03T17:00:00Z")
+	second.Id = "b"
+	single := syncedEvent("2", "Other", "2025-03-04T17:00:00Z")
+	single.Id = "c"
+	
+	mockCalendar := &MockCalendarService{existingEvents: []*calendar.Event{first, second, single}}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{})
+	now := time.Date(2025, 4, 2, 12, 0, 0, 0, time.UTC)
+	syncService.SetClock(util.FixedClock{Time: now})
+	
+	plan, err := syncService.PlanDedupe("2025-03-01T00:00:00Z", "2025-04-01T00:00:00Z")
+	if err != nil {
+		t.Fatalf("PlanDedupe returned error: %v", err)
+	}
+	if !plan.CreatedAt.Equal(now) {
+		t.Errorf("Expected the plan to be dated by the service clock, got %v", plan.CreatedAt)
+	}
+	if mockCalendar.timeMin != "2025-03-01T00:00:00Z" || mockCalendar.timeMax != "2025-04-01T00:00:00Z" {
+		t.Errorf("Expected the requested range to be scanned, got %s - %s", mockCalendar.timeMin, mockCalendar.timeMax)
+	}
+	if len(plan.Operations) != 1 || plan.Operations[0].EventID != "b" {
+		t.Fatalf("Expected a single delete of b, got %+v", plan.Operations)
+	}
+	
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Deleted != 1 || mockCalendar.createCalls != 0 || mockCalendar.updateCalls != 0 {
+		t.Errorf("Expected only the duplicate to be deleted, got %+v", stats)
+	}
+}
+
+// TestPlanInstanceOwnership verifies that deployments sharing a calendar only touch their own events
+func TestPlanInstanceOwnership(t *testing.T) {
+	tagged := func(pike13ID, summary, instance string) *calendar.Event {
+		event := syncedEvent(pike13ID, summary, "2025-05-12T17:00:00Z")
+		event.Id = "evt" + pike13ID
+		if instance != "" {
+			event.ExtendedProperties.Private[calendar.PropertyInstance] = instance
+		}
+		return event
+	}
+	existing := []*calendar.Event{
+		tagged("1", "Ours", "studio-a"),
+		tagged("2", "Theirs", "studio-b"),
+		tagged("3", "Legacy", ""),
+	}
+	
+	testCases := []struct {
+		name        string
+		adopt       bool
+		expectedOps map[string]sync.OperationKind
+	}{
+		{
+			name:  "Legacy events are adopted",
+			adopt: true,
+			expectedOps: map[string]sync.OperationKind{
+				"1": sync.OpDelete,
+				"3": sync.OpUpdate,
+			},
+		},
+		{
+			name:  "Legacy events are left alone",
+			adopt: false,
+			expectedOps: map[string]sync.OperationKind{
+				"1": sync.OpDelete,
+				"3": sync.OpCreate,
+			},
+		},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCalendar := &MockCalendarService{existingEvents: existing}
+			cfg := &config.Config{InstanceID: "studio-a", AdoptUntagged: tc.adopt}
+			plan, err := sync.NewSyncService(mockCalendar, cfg).Plan([]pike13.Pike13Event{
+				{ID: 3, Name: "Legacy", StartAt: "2025-05-12T17:00:00Z"},
+			}, "", "")
+			if err != nil {
+				t.Fatalf("Plan returned error: %v", err)
+			}
+			
+			ops := make(map[string]sync.OperationKind)
+			for _, op := range plan.Operations {
+				ops[op.Pike13ID] = op.Kind
+				if op.Kind == sync.OpUpdate {
+					last := op.Diffs[len(op.Diffs)-1]
+					if last.Field != calendar.PropertyInstance || last.New != "studio-a" {
+						t.Errorf("Expected the adopted event to be tagged, got diffs %+v", op.Diffs)
+					}
+				}
+			}
+			if len(ops) != len(tc.expectedOps) {
+				t.Errorf("Expected operations %v, got %v", tc.expectedOps, ops)
+			}
+			for pike13ID, kind := range tc.expectedOps {
+				if ops[pike13ID] != kind {
+					t.Errorf("Expected %s for Pike13 event %s, got %q", kind, pike13ID, ops[pike13ID])
+				}
+			}
+			if _, touched := ops["2"]; touched {
+				t.Error("Another instance's event was touched")
+			}
+		})
+	}
+}
+
+// TestApplyConcurrent verifies that parallel workers give the same result as a sequential run
+func TestApplyConcurrent(t *testing.T) {
+	var pike13Events []pike13.Pike13Event
+	for i := 1; i <= 40; i++ {
+		pike13Events = append(pike13Events, pike13.Pike13Event{ID: i, Name: "Class " + strconv.Itoa(i), StartAt: "2025-05-12T17:00:00Z"})
+	}
+	failing := map[string]bool{"Class 3": true, "Class 17": true}
+	
+	run := func(concurrency int) (sync.SyncStats, *MockCalendarService) {
+		mockCalendar := &MockCalendarService{
+			failing: failing,
+			// Early operations are the slowest, so they finish last
+			delay: func(summary string) time.Duration {
+				id, _ := strconv.Atoi(strings.TrimPrefix(summary, "Class "))
+				return time.Duration(40-id) * 100 * time.Microsecond
+			},
+		}
+		cfg := &config.Config{CalendarConcurrency: concurrency}
+		stats, err := sync.NewSyncService(mockCalendar, cfg).SyncEvents(pike13Events, "", "")
+		if err != nil {
+			t.Fatalf("SyncEvents returned error: %v", err)
+		}
+		return stats, mockCalendar
+	}
+	
+	sequential, _ := run(1)
+	parallel, mockCalendar := run(8)
+	
+	if parallel.Created != 38 || parallel.Failed != 2 || mockCalendar.createCalls != 40 {
+		t.Errorf("Expected 38 creates and 2 failures from 40 calls, got %+v after %d calls", parallel, mockCalendar.createCalls)
+	}
+	if len(parallel.Outcomes) != len(sequential.Outcomes) {
+		t.Fatalf("Expected %d outcomes, got %d", len(sequential.Outcomes), len(parallel.Outcomes))
+	}
+	for i := range sequential.Outcomes {
+		if parallel.Outcomes[i].Pike13ID != sequential.Outcomes[i].Pike13ID || parallel.Outcomes[i].Result != sequential.Outcomes[i].Result {
+			t.Errorf("Outcome %d differs: sequential %+v, parallel %+v", i, sequential.Outcomes[i], parallel.Outcomes[i])
+		}
+	}
+	
+	// The completion order really was shuffled, or the test proves nothing
+	inOrder := true
+	for i, summary := range mockCalendar.touched {
+		if summary != "Class "+strconv.Itoa(i+1) {
+			inOrder = false
+		}
+	}
+	if inOrder {
+		t.Error("Expected parallel calls to complete out of order")
+	}
+}
+
+// BatchMockCalendarService adds batch support to the mock, recording batch sizes
+type BatchMockCalendarService struct {
+	*MockCalendarService
+	batches []int
+}
+
+// ExecuteBatch mocks a batch request by applying each item on its own
+func (m *BatchMockCalendarService) ExecuteBatch(ops []calendar.BatchOp) []calendar.BatchResult {
+	m.mu.Lock()
+	m.batches = append(m.batches, len(ops))
+	m.mu.Unlock()
+	
+	results := make([]calendar.BatchResult, len(ops))
+	for i, op := range ops {
+		switch op.Kind {
+		case calendar.BatchInsert:
+			results[i].Result, results[i].Err = m.CreateEvent(op.Event)
+		case calendar.BatchUpdate:
+			results[i].Result, results[i].Err = m.UpdateEvent(op.EventID, op.Event)
+		case calendar.BatchDelete:
+			results[i].Result, results[i].Err = m.DeleteEvent(op.Event)
+		}
+	}
+	return results
+}
+
+// TestApplyBatched tests that operations are grouped into batches and that
+// failures inside a batch are reported against the right Pike13 event
+func TestApplyBatched(t *testing.T) {
+	var pike13Events []pike13.Pike13Event
+	for i := 1; i <= 5; i++ {
+		pike13Events = append(pike13Events, pike13.Pike13Event{ID: i, Name: "Class " + strconv.Itoa(i), StartAt: "2025-05-12T17:00:00Z"})
+	}
+	mockCalendar := &BatchMockCalendarService{
+		MockCalendarService: &MockCalendarService{
+			existingEvents: []*calendar.Event{syncedEvent("99", "Old Class", "2025-05-12T17:00:00Z")},
+			failing:        map[string]bool{"Class 4": true},
+		},
+	}
+	cfg := &config.Config{CalendarConcurrency: 1, CalendarBatchSize: 4}
+	
+	stats, err := sync.NewSyncService(mockCalendar, cfg).SyncEvents(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	
+	// Six operations in batches of four; the last two still form a batch
+	if len(mockCalendar.batches) != 2 || mockCalendar.batches[0] != 4 || mockCalendar.batches[1] != 2 {
+		t.Errorf("Expected batches of [4 2], got %v", mockCalendar.batches)
+	}
+	if stats.Created != 4 || stats.Deleted != 1 || stats.Failed != 1 {
+		t.Errorf("Expected 4 creates, 1 delete and 1 failure, got %+v", stats)
+	}
+	errs := stats.Errors()
+	if len(errs) != 1 || errs[0].Pike13ID != "4" {
+		t.Errorf("Expected the failure to be reported for Pike13 event 4, got %+v", errs)
+	}
+	
+	// Without a batch size every operation is sent on its own
+	mockCalendar.batches = nil
+	cfg.CalendarBatchSize = 1
+	if _, err := sync.NewSyncService(mockCalendar, cfg).SyncEvents(pike13Events, "", ""); err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	if len(mockCalendar.batches) != 0 {
+		t.Errorf("Expected no batches with batching disabled, got %v", mockCalendar.batches)
+	}
+}
+
+// TestPlanConflicts tests how each conflict policy treats events edited in
+// Google Calendar since they were synced
+func TestPlanConflicts(t *testing.T) {
+	mockCalendar := &MockCalendarService{}
+	pike13Events := []pike13.Pike13Event{
+		{ID: 1, Name: "Yoga", StartAt: "2025-05-12T17:00:00Z"},
+		{ID: 2, Name: "Spin", StartAt: "2025-05-13T17:00:00Z"},
+		{ID: 3, Name: "Boxing", StartAt: "2025-05-14T17:00:00Z"},
+	}
+	
+	// Event 1 was renamed by hand, event 2 too and Pike13 has since moved it
+	editedOnly := writtenEvent(mockCalendar, pike13Events[0], "evt1")
+	editedOnly.Summary = "Yoga (Room 2)"
+	editedBoth := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 2, Name: "Spin", StartAt: "2025-05-13T16:00:00Z"}, "evt2")
+	editedBoth.Summary = "Spin - bring water"
+	untouched := writtenEvent(mockCalendar, pike13Events[2], "evt3")
+	mockCalendar.existingEvents = []*calendar.Event{editedOnly, editedBoth, untouched}
+	
+	testCases := []struct {
+		policy      string
+		forceUpdate bool
+		updates     []string // Pike13 IDs updated
+		accepts     []string // Pike13 IDs whose edit is accepted
+		conflicts   map[string]string
+	}{
+		{
+			policy:    sync.ConflictPolicyPike13,
+			updates:   []string{"1", "2"},
+			conflicts: map[string]string{"1": sync.ResolutionOverwritten, "2": sync.ResolutionOverwritten},
+		},
+		{
+			policy:    sync.ConflictPolicyCalendar,
+			accepts:   []string{"1", "2"},
+			conflicts: map[string]string{"1": sync.ResolutionKept, "2": sync.ResolutionKept},
+		},
+		{
+			policy:    sync.ConflictPolicySkip,
+			conflicts: map[string]string{"1": sync.ResolutionSkipped, "2": sync.ResolutionSkipped},
+		},
+		{
+			policy:      sync.ConflictPolicySkip,
+			forceUpdate: true,
+			updates:     []string{"1", "2", "3"},
+			conflicts:   map[string]string{"1": sync.ResolutionOverwritten, "2": sync.ResolutionOverwritten},
+		},
+	}
+	
+	for _, tc := range testCases {
+		cfg := &config.Config{ConflictPolicy: tc.policy, ForceUpdate: tc.forceUpdate}
+		plan, err := sync.NewSyncService(mockCalendar, cfg).Plan(pike13Events, "", "")
+		if err != nil {
+			t.Fatalf("%s: Plan returned error: %v", tc.policy, err)
+		}
+		
+		var updates, accepts []string
+		for _, op := range plan.Operations {
+			if op.Kind == sync.OpAccept {
+				accepts = append(accepts, op.Pike13ID)
+				continue
+			}
+			updates = append(updates, op.Pike13ID)
+			if op.Conflict != (tc.conflicts[op.Pike13ID] == sync.ResolutionOverwritten) {
+				t.Errorf("%s: unexpected conflict flag on update of %s", tc.policy, op.Pike13ID)
+			}
+		}
+		if strings.Join(updates, ",") != strings.Join(tc.updates, ",") {
+			t.Errorf("%s: expected updates of %v, got %v", tc.policy, tc.updates, updates)
+		}
+		if strings.Join(accepts, ",") != strings.Join(tc.accepts, ",") {
+			t.Errorf("%s: expected accepted edits of %v, got %v", tc.policy, tc.accepts, accepts)
+		}
+		if plan.Unchanged != 3-len(updates)-len(accepts) {
+			t.Errorf("%s: expected %d unchanged, got %d", tc.policy, 3-len(updates)-len(accepts), plan.Unchanged)
+		}
+		
+		if len(plan.Conflicts) != len(tc.conflicts) {
+			t.Errorf("%s: expected %d conflicts, got %+v", tc.policy, len(tc.conflicts), plan.Conflicts)
+		}
+		for _, conflict := range plan.Conflicts {
+			if conflict.Resolution != tc.conflicts[conflict.Pike13ID] {
+				t.Errorf("%s: expected %s resolution for %s, got %s", tc.policy, tc.conflicts[conflict.Pike13ID], conflict.Pike13ID, conflict.Resolution)
+			}
+			if conflict.Pike13Changed != (conflict.Pike13ID == "2") {
+				t.Errorf("%s: wrong Pike13 change flag on %+v", tc.policy, conflict)
+			}
+		}
+		if stats := plan.Stats(); len(stats.Conflicts) != len(plan.Conflicts) {
+			t.Errorf("%s: expected conflicts in the stats, got %d", tc.policy, len(stats.Conflicts))
+		}
+	}
+}
+
+// TestConflictPolicyNextRun tests that the calendar policy accepts an edit
+// once while the skip policy flags it again on every run
+func TestConflictPolicyNextRun(t *testing.T) {
+	pike13Event := pike13.Pike13Event{ID: 1, Name: "Yoga", StartAt: "2025-05-12T17:00:00Z"}
+	edited := writtenEvent(&MockCalendarService{}, pike13Event, "evt1")
+	edited.Summary = "Yoga (Room 2)"
+	
+	// Calendar: the first run restamps the event without changing its content
+	mockCalendar := &MockCalendarService{existingEvents: []*calendar.Event{edited}}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{ConflictPolicy: sync.ConflictPolicyCalendar})
+	plan, err := syncService.Plan([]pike13.Pike13Event{pike13Event}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpAccept {
+		t.Fatalf("Expected the edit to be accepted, got %+v", plan.Operations)
+	}
+	accepted := plan.Operations[0].Event
+	if accepted.Summary != "Yoga (Room 2)" || calendar.IsEdited(accepted) {
+		t.Errorf("Expected the edited event restamped as is, got %+v", accepted)
+	}
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Skipped != 1 || stats.Updated != 0 || len(stats.Conflicts) != 1 {
+		t.Errorf("Expected 1 skipped event and 1 conflict, got %+v", stats)
+	}
+	
+	// The second run leaves it alone and no longer reports it
+	mockCalendar.existingEvents = []*calendar.Event{accepted}
+	plan, err = syncService.Plan([]pike13.Pike13Event{pike13Event}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 0 || len(plan.Conflicts) != 0 || plan.Unchanged != 1 {
+		t.Errorf("Expected the accepted edit to be left alone quietly, got %+v and %+v", plan.Operations, plan.Conflicts)
+	}
+	
+	// A later Pike13 change is reported once and does not overwrite the edit
+	moved := pike13Event
+	moved.StartAt = "2025-05-12T18:00:00Z"
+	plan, err = syncService.Plan([]pike13.Pike13Event{moved}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpAccept || len(plan.Conflicts) != 1 || !plan.Conflicts[0].Pike13Changed {
+		t.Fatalf("Expected the Pike13 change to be reported and dropped, got %+v and %+v", plan.Operations, plan.Conflicts)
+	}
+	mockCalendar.existingEvents = []*calendar.Event{plan.Operations[0].Event}
+	plan, err = syncService.Plan([]pike13.Pike13Event{moved}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 0 || len(plan.Conflicts) != 0 {
+		t.Errorf("Expected the dropped change to stay dropped, got %+v and %+v", plan.Operations, plan.Conflicts)
+	}
+	
+	// Skip: nothing is written and the edit is reported on every run
+	mockCalendar = &MockCalendarService{existingEvents: []*calendar.Event{edited}}
+	syncService = sync.NewSyncService(mockCalendar, &config.Config{ConflictPolicy: sync.ConflictPolicySkip})
+	for run := 1; run <= 2; run++ {
+		plan, err := syncService.Plan([]pike13.Pike13Event{pike13Event}, "", "")
+		if err != nil {
+			t.Fatalf("Plan returned error: %v", err)
+		}
+		if len(plan.Operations) != 0 || len(plan.Conflicts) != 1 || plan.Conflicts[0].Resolution != sync.ResolutionSkipped {
+			t.Errorf("Run %d: expected the edit to be skipped and reported, got %+v and %+v", run, plan.Operations, plan.Conflicts)
+		}
+		if _, err := syncService.Apply(plan); err != nil {
+			t.Fatalf("Apply returned error: %v", err)
+		}
+	}
+	if mockCalendar.updateCalls != 0 {
+		t.Errorf("Expected no writes under the skip policy, got %d", mockCalendar.updateCalls)
+	}
+}
+
+// TestPlanRemovalPolicies tests that events gone from Pike13 are deleted,
+// cancelled or marked depending on whether they already started
+func TestPlanRemovalPolicies(t *testing.T) {
+	mockCalendar := &MockCalendarService{}
+	past := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 1, Name: "Monday Class", StartAt: "2025-05-12T17:00:00Z"}, "evt1")
+	future := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 2, Name: "Wednesday Class", StartAt: "2025-05-14T17:00:00Z"}, "evt2")
+	mockCalendar.existingEvents = []*calendar.Event{past, future}
+	
+	cfg := &config.Config{RemovalPolicyPast: sync.RemovalPolicyMark, RemovalPolicyFuture: sync.RemovalPolicyCancel, AllowEmptyPike13: true}
+	syncService := sync.NewSyncService(mockCalendar, cfg)
+	syncService.SetClock(util.FixedClock{Time: time.Date(2025, 5, 13, 12, 0, 0, 0, time.UTC)})
+	
+	plan, err := syncService.Plan(nil, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 2 || plan.Operations[0].Kind != sync.OpMark || plan.Operations[1].Kind != sync.OpCancel {
+		t.Fatalf("Expected to mark the past event and cancel the future one, got %+v", plan.Operations)
+	}
+	marked := plan.Operations[0].Event
+	if marked.Summary != sync.RemovedPrefix+"Monday Class" || marked.ColorId != calendar.DefaultCancelledColor || !calendar.IsRemoved(marked) || calendar.IsEdited(marked) {
+		t.Errorf("Unexpected marked event: %+v", marked)
+	}
+	if past.Summary != "Monday Class" || calendar.IsRemoved(past) {
+		t.Error("Expected the existing event to be left unmodified by planning")
+	}
+	if plan.Operations[1].Event.Status != "cancelled" {
+		t.Errorf("Expected a cancelled status, got %q", plan.Operations[1].Event.Status)
+	}
+	
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Marked != 1 || stats.Cancelled != 1 || stats.Updated != 0 || stats.Deleted != 0 || mockCalendar.deleteCalls != 0 {
+		t.Errorf("Expected 1 marked and 1 cancelled event without deletes, got %+v", stats)
+	}
+	
+	// A marked event is left alone until its occurrence comes back
+	mockCalendar.existingEvents = []*calendar.Event{marked}
+	plan, err = syncService.Plan(nil, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 0 {
+		t.Errorf("Expected no operations for an event already marked, got %+v", plan.Operations)
+	}
+	
+	plan, err = syncService.Plan([]pike13.Pike13Event{{ID: 1, Name: "Monday Class", StartAt: "2025-05-12T17:00:00Z"}}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpUpdate || calendar.IsRemoved(plan.Operations[0].Event) {
+		t.Errorf("Expected the returning event to be restored, got %+v", plan.Operations)
+	}
+	
+	// Deleting stays the default
+	syncService = sync.NewSyncService(mockCalendar, &config.Config{AllowEmptyPike13: true})
+	mockCalendar.existingEvents = []*calendar.Event{future}
+	plan, err = syncService.Plan(nil, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if plan.Count(sync.OpDelete) != 1 {
+		t.Errorf("Expected a delete by default, got %+v", plan.Operations)
+	}
+}
+
+// TestPlanRemovalPoliciesFromState verifies removals planned while the
+// calendar cannot be listed: cancelling is a status change and still goes
+// ahead, but marking waits for the full events
+func TestPlanRemovalPoliciesFromState(t *testing.T) {
+	st := state.New(filepath.Join(t.TempDir(), "state.json"))
+	mockCalendar := &MockCalendarService{}
+	cfg := &config.Config{RemovalPolicyPast: sync.RemovalPolicyMark, RemovalPolicyFuture: sync.RemovalPolicyCancel, AllowEmptyPike13: true}
+	syncService := sync.NewSyncService(mockCalendar, cfg)
+	syncService.SetState(st)
+	syncService.SetClock(util.FixedClock{Time: time.Date(2025, 5, 13, 12, 0, 0, 0, time.UTC)})
+	
+	pike13Events := []pike13.Pike13Event{
+		{ID: 1, Name: "Monday Class", StartAt: "2025-05-12T17:00:00Z", State: "active"},
+		{ID: 2, Name: "Wednesday Class", StartAt: "2025-05-14T17:00:00Z", State: "active"},
+	}
+	if _, err := syncService.SyncEvents(pike13Events, "", ""); err != nil {
+		t.Fatalf("SyncEvents returned error: %v", err)
+	}
+	
+	mockCalendar.listErr = errors.New("listing unavailable")
+	plan, err := syncService.Plan(nil, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if !plan.FromState {
+		t.Fatal("Expected the plan to be built from state")
+	}
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpCancel || plan.Operations[0].Pike13ID != "2" {
+		t.Fatalf("Expected only the future event to be cancelled, got %+v", plan.Operations)
+	}
+	
+	mockCalendar.touched = nil
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Cancelled != 1 || stats.Marked != 0 || len(mockCalendar.touched) != 1 || mockCalendar.touched[0] != "Wednesday Class" {
+		t.Errorf("Expected only the future event to be written, got %+v touching %v", stats, mockCalendar.touched)
+	}
+}
+
+// TestPlanFreezePastEvents verifies that events which ended before the grace
+// period, and their duplicates, are neither updated nor removed
+func TestPlanFreezePastEvents(t *testing.T) {
+	mockCalendar := &MockCalendarService{}
+	old := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 1, Name: "Monday Class", StartAt: "2025-05-12T17:00:00Z"}, "evt1")
+	recent := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 2, Name: "Tuesday Class", StartAt: "2025-05-13T09:00:00Z"}, "evt2")
+	gone := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 3, Name: "Sunday Class", StartAt: "2025-05-11T17:00:00Z"}, "evt3")
+	// An extra copy of the old event
+	copied := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 1, Name: "Monday Class", StartAt: "2025-05-12T17:00:00Z"}, "evt4")
+	mockCalendar.existingEvents = []*calendar.Event{old, recent, gone, copied}
+	
+	cfg := &config.Config{FreezePastEvents: true, FreezeGrace: config.Duration{Duration: 6 * time.Hour}}
+	syncService := sync.NewSyncService(mockCalendar, cfg)
+	syncService.SetClock(util.FixedClock{Time: time.Date(2025, 5, 13, 12, 0, 0, 0, time.UTC)})
+	
+	pike13Events := []pike13.Pike13Event{
+		{ID: 1, Name: "Monday Class (moved)", StartAt: "2025-05-12T17:00:00Z"},
+		{ID: 2, Name: "Tuesday Class (moved)", StartAt: "2025-05-13T09:00:00Z"},
+	}
+	plan, err := syncService.Plan(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	// Only the event inside the grace period may still change
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpUpdate || plan.Operations[0].EventID != "evt2" {
+		t.Fatalf("Expected a single update of the recent event, got %+v", plan.Operations)
+	}
+	if plan.Frozen != 3 || len(plan.Duplicates) != 1 {
+		t.Errorf("Expected 3 frozen events including the duplicate, got %d", plan.Frozen)
+	}
+	var out bytes.Buffer
+	plan.Describe(&out)
+	if !strings.Contains(out.String(), "1 duplicate event(s) of past events left in place") || strings.Contains(out.String(), "duplicate_policy is report") {
+		t.Errorf("Expected the duplicate to be reported as frozen, got:\n%s", out.String())
+	}
+	
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Frozen != 3 || stats.Updated != 1 || stats.Deleted != 0 || mockCalendar.deleteCalls != 0 {
+		t.Errorf("Expected 3 frozen and 1 updated event, got %+v", stats)
+	}
+	
+	// Without the policy past events follow Pike13
+	cfg.FreezePastEvents = false
+	plan, err = syncService.Plan(pike13Events, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	if plan.Count(sync.OpUpdate) != 2 || plan.Count(sync.OpDelete) != 2 || plan.Frozen != 0 {
+		t.Errorf("Expected 2 updates and 2 deletes without freezing, got %+v", plan.Operations)
+	}
+}
+
+// TestPlanFilter verifies that filtered out events are not synced and their
+// calendar events are deleted regardless of the removal policy
+func TestPlanFilter(t *testing.T) {
+	mockCalendar := &MockCalendarService{}
+	kept := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 1, Name: "Yoga", StartAt: "2025-05-12T17:00:00Z"}, "evt1")
+	private := writtenEvent(mockCalendar, pike13.Pike13Event{ID: 2, Name: "Private Training", StartAt: "2025-05-13T17:00:00Z"}, "evt2")
+	mockCalendar.existingEvents = []*calendar.Event{kept, private}
+	
+	f, err := filter.New([]config.FilterRule{
+		{Name: "private", Action: filter.ActionExclude, EventCondition: config.EventCondition{NamePattern: "Private"}},
+	}, time.UTC)
+	if err != nil {
+		t.Fatalf("filter.New returned error: %v", err)
+	}
+	syncService := sync.NewSyncService(mockCalendar, &config.Config{
+		RemovalPolicyPast:   sync.RemovalPolicyDelete,
+		RemovalPolicyFuture: sync.RemovalPolicyCancel,
+	})
+	syncService.SetClock(util.FixedClock{Time: time.Date(2025, 5, 12, 12, 0, 0, 0, time.UTC)})
+	syncService.SetFilter(f)
+	
+	plan, err := syncService.Plan([]pike13.Pike13Event{
+		{ID: 1, Name: "Yoga", StartAt: "2025-05-12T17:00:00Z"},
+		{ID: 2, Name: "Private Training", StartAt: "2025-05-13T17:00:00Z"},
+		{ID: 3, Name: "Private Training", StartAt: "2025-05-14T17:00:00Z"},
+	}, "", "")
+	if err != nil {
+		t.Fatalf("Plan returned error: %v", err)
+	}
+	
+	// The filtered class is upcoming, so removal_policy_future applies
+	if len(plan.Operations) != 1 || plan.Operations[0].Kind != sync.OpCancel || plan.Operations[0].EventID != "evt2" || !plan.Operations[0].Filtered {
+		t.Fatalf("Expected only a cancel of the filtered event, got %+v", plan.Operations)
+	}
+	if plan.Filtered["private"] != 2 || plan.Unchanged != 1 || plan.Pike13Events != 3 {
+		t.Errorf("Expected 2 filtered and 1 unchanged of 3 events, got %v, %d, %d", plan.Filtered, plan.Unchanged, plan.Pike13Events)
+	}
+	
+	// A rule change removing half the calendar needs --force like any other
+	if err := plan.CheckSafeguards(&config.Config{MaxDeletePercent: 10}); !errors.Is(err, sync.ErrUnsafePlan) {
+		t.Errorf("Expected filtered removals to trip the safeguards, got %v", err)
+	}
+	
+	var out bytes.Buffer
+	plan.Describe(&out)
+	if !strings.Contains(out.String(), "CANCEL (filtered out): Private Training") || !strings.Contains(out.String(), "private: 2") {
+		t.Errorf("Expected the filter in the plan output, got:\n%s", out.String())
+	}
+	
+	stats, err := syncService.Apply(plan)
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if stats.Cancelled != 1 || stats.Deleted != 0 || stats.Filtered["private"] != 2 || mockCalendar.createCalls != 0 {
+		t.Errorf("Expected 1 cancel and 2 filtered events, got %+v", stats)
+	}
+}
+
+// TestCheckPolicies verifies that mistyped policies are rejected instead of
+// falling back to a default
+func TestCheckPolicies(t *testing.T) {
+	valid := config.Config{
+		RemovalPolicyPast:   sync.RemovalPolicyMark,
+		RemovalPolicyFuture: sync.RemovalPolicyCancel,
+		ConflictPolicy:      sync.ConflictPolicySkip,
+		DuplicatePolicy:     sync.DuplicatePolicyReport,
+	}
+	if err := sync.CheckPolicies(&valid); err != nil {
+		t.Errorf("Expected valid policies to pass, got %v", err)
+	}
+	
+	invalid := []struct {
+		name   string
+		set    func(*config.Config, string)
+		values []string
+	}{
+		{"removal policy", func(c *config.Config, v string) { c.RemovalPolicyFuture = v }, []string{"Mark", "cancelled", ""}},
+		{"conflict policy", func(c *config.Config, v string) { c.ConflictPolicy = v }, []string{"Pike13", "google", ""}},
+		{"duplicate policy", func(c *config.Config, v string) { c.DuplicatePolicy = v }, []string{"reprot", "keep", ""}},
+	}
+	for _, tc := range invalid {
+		for _, value := range tc.values {
+			cfg := valid
+			tc.set(&cfg, value)
+			if err := sync.CheckPolicies(&cfg); err == nil {
+				t.Errorf("Expected %s %q to be rejected", tc.name, value)
+			}
+		}
+	}
+}
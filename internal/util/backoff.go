@@ -0,0 +1,26 @@
+package util
+
+import (
+	"math/rand"
+	"time"
+)
+
+// BackoffDelay returns a jittered exponential backoff for the given retry
+// (1 for the first retry). The delay doubles from base up to max and is then
+// randomized to between half and all of that value.
+func BackoffDelay(base, max time.Duration, retry int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	
+	delay := base
+	for i := 1; i < retry && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"time"
+)
+
+// Clock tells the current time. Code that depends on "now" takes a Clock so
+// tests can fix the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real wall clock
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FixedClock always returns the same time
+type FixedClock struct {
+	Time time.Time
+}
+
+// Now returns the fixed time
+func (c FixedClock) Now() time.Time {
+	return c.Time
+}
@@ -0,0 +1,42 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out calls so they stay under a queries-per-second limit.
+// It is safe for concurrent use. A nil RateLimiter never waits.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns a limiter allowing qps calls per second, or nil
+// (no limit) when qps is not positive
+func NewRateLimiter(qps float64) *RateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// Wait blocks until the next call is allowed
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	
+	// Reserve the next slot, then sleep outside the lock
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	
+	time.Sleep(wait)
+}
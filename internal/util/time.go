@@ -1,6 +1,8 @@
 package util
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -21,3 +23,33 @@ func GetStartAndEndOfWeek() (string, string) {
 	
 	return startOfWeek.Format(time.RFC3339), endOfWeek.Format(time.RFC3339)
 }
+
+// ParseWeekday parses a day name such as "sunday" or "Mon"
+func ParseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || (len(name) >= 3 && strings.HasPrefix(full, name)) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday %q", name)
+}
+
+// SyncWindow returns the range of a rolling sync window in loc. It starts at
+// midnight on the first day (weekStart) of the current week, moved back by
+// lookbackDays, and ends at midnight after the current week, moved forward by
+// lookaheadDays. Days are calendar days, so windows spanning a DST change are
+// an hour shorter or longer but always start and end at midnight.
+func SyncWindow(clock Clock, loc *time.Location, weekStart time.Weekday, lookbackDays, lookaheadDays int) (time.Time, time.Time) {
+	now := clock.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	
+	// Days since the start of the week, 0 to 6
+	sinceWeekStart := (int(today.Weekday()) - int(weekStart) + 7) % 7
+	startOfWeek := today.AddDate(0, 0, -sinceWeekStart)
+	
+	from := startOfWeek.AddDate(0, 0, -lookbackDays)
+	to := startOfWeek.AddDate(0, 0, 7+lookaheadDays)
+	return from, to
+}
@@ -116,3 +116,124 @@ func TestGetStartAndEndOfWeek(t *testing.T) {
 		t.Errorf("Expected end date to be %v, got %v", expectedEnd, endDate)
 	}
 }
+
+// TestBackoffDelay tests the jittered exponential backoff
+func TestBackoffDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	max := time.Second
+	
+	testCases := []struct {
+		retry    int
+		expected time.Duration // Upper bound; jitter keeps the delay above half of it
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second}, // Capped at max
+		{50, time.Second},
+	}
+	
+	for _, tc := range testCases {
+		for i := 0; i < 20; i++ {
+			delay := util.BackoffDelay(base, max, tc.retry)
+			if delay < tc.expected/2 || delay > tc.expected {
+				t.Errorf("BackoffDelay(retry %d) = %s, expected between %s and %s",
+					tc.retry, delay, tc.expected/2, tc.expected)
+			}
+		}
+	}
+	
+	if delay := util.BackoffDelay(0, max, 3); delay != 0 {
+		t.Errorf("Expected no delay without a base, got %s", delay)
+	}
+}
+
+// TestRateLimiter tests that calls are spaced out to the configured rate
+func TestRateLimiter(t *testing.T) {
+	// No limit never waits
+	unlimited := util.NewRateLimiter(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		unlimited.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected no waiting without a limit, took %v", elapsed)
+	}
+	
+	// 100 QPS: the first call is immediate, the next 10 take about 100ms
+	limiter := util.NewRateLimiter(100)
+	start = time.Now()
+	for i := 0; i < 11; i++ {
+		limiter.Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected 11 calls at 100 QPS to take at least 90ms, took %v", elapsed)
+	}
+}
+
+// TestSyncWindow tests the rolling sync window across weekdays, week start
+// days, DST transitions and year boundaries
+func TestSyncWindow(t *testing.T) {
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+	
+	testCases := []struct {
+		name      string
+		now       time.Time
+		weekStart time.Weekday
+		lookback  int
+		lookahead int
+		from      string
+		to        string
+	}{
+		{"Sunday starts its own week", time.Date(2025, 5, 11, 9, 0, 0, 0, la), time.Sunday, 0, 0,
+			"2025-05-11T00:00:00-07:00", "2025-05-18T00:00:00-07:00"},
+		{"Wednesday", time.Date(2025, 5, 14, 23, 30, 0, 0, la), time.Sunday, 0, 0,
+			"2025-05-11T00:00:00-07:00", "2025-05-18T00:00:00-07:00"},
+		{"Saturday looks ahead like any other day", time.Date(2025, 5, 17, 12, 0, 0, 0, la), time.Sunday, 0, 7,
+			"2025-05-11T00:00:00-07:00", "2025-05-25T00:00:00-07:00"},
+		{"Monday week start on a Sunday", time.Date(2025, 5, 18, 8, 0, 0, 0, la), time.Monday, 0, 0,
+			"2025-05-12T00:00:00-07:00", "2025-05-19T00:00:00-07:00"},
+		{"Lookback and three weeks ahead", time.Date(2025, 5, 14, 8, 0, 0, 0, la), time.Sunday, 2, 21,
+			"2025-05-09T00:00:00-07:00", "2025-06-08T00:00:00-07:00"},
+		{"Late evening UTC is still the local day", time.Date(2025, 5, 18, 5, 0, 0, 0, time.UTC), time.Sunday, 0, 0,
+			"2025-05-11T00:00:00-07:00", "2025-05-18T00:00:00-07:00"},
+		{"Spring forward", time.Date(2025, 3, 10, 12, 0, 0, 0, la), time.Sunday, 0, 0,
+			"2025-03-09T00:00:00-08:00", "2025-03-16T00:00:00-07:00"},
+		{"Fall back", time.Date(2025, 11, 1, 12, 0, 0, 0, la), time.Sunday, 0, 7,
+			"2025-10-26T00:00:00-07:00", "2025-11-09T00:00:00-08:00"},
+		{"Year boundary", time.Date(2025, 12, 31, 12, 0, 0, 0, la), time.Sunday, 0, 7,
+			"2025-12-28T00:00:00-08:00", "2026-01-11T00:00:00-08:00"},
+		{"Lookback into the previous year", time.Date(2026, 1, 2, 12, 0, 0, 0, la), time.Monday, 7, 0,
+			"2025-12-22T00:00:00-08:00", "2026-01-05T00:00:00-08:00"},
+	}
+	
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			from, to := util.SyncWindow(util.FixedClock{Time: tc.now}, la, tc.weekStart, tc.lookback, tc.lookahead)
+			if got := from.Format(time.RFC3339); got != tc.from {
+				t.Errorf("Expected window to start %s, got %s", tc.from, got)
+			}
+			if got := to.Format(time.RFC3339); got != tc.to {
+				t.Errorf("Expected window to end %s, got %s", tc.to, got)
+			}
+		})
+	}
+}
+
+// TestParseWeekday tests parsing week start days
+func TestParseWeekday(t *testing.T) {
+	for name, expected := range map[string]time.Weekday{"sunday": time.Sunday, "Monday": time.Monday, " sat ": time.Saturday, "thu": time.Thursday} {
+		if day, err := util.ParseWeekday(name); err != nil || day != expected {
+			t.Errorf("ParseWeekday(%q) = %s, %v; expected %s", name, day, err, expected)
+		}
+	}
+	for _, name := range []string{"", "su", "funday"} {
+		if _, err := util.ParseWeekday(name); err == nil {
+			t.Errorf("Expected error for %q", name)
+		}
+	}
+}